@@ -0,0 +1,58 @@
+package grom
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Chain is a reusable list of middleware that can be added to several routers with Router.Middleware
+// or Router.RoutedMiddleware. A chain never changes once it's made: Append and Extend return new chains.
+// The middleware of a chain is validated once for each context type it's added with,
+// and the resulting handlers are shared by all the routers it's added to.
+type Chain struct {
+	middleware []interface{}
+
+	mu       sync.Mutex
+	handlers map[reflect.Type][]*middlewareHandler
+}
+
+// NewChain returns a chain of the specified middleware, which can be anything Router.Middleware accepts,
+// including middleware returned by When and other chains.
+//
+//	var base = grom.NewChain(grom.LoggerMiddleware, grom.ShowErrorsMiddleware, (*Context).SetRequestID)
+//	router.Middleware(base)
+//	admin.Middleware(base.Append((*AdminContext).RequireAdmin))
+func NewChain(fns ...interface{}) *Chain {
+	return &Chain{middleware: append([]interface{}(nil), fns...)}
+}
+
+// Append returns a new chain with the middleware of c followed by fns. c isn't changed.
+func (c *Chain) Append(fns ...interface{}) *Chain {
+	middleware := make([]interface{}, 0, len(c.middleware)+len(fns))
+	middleware = append(middleware, c.middleware...)
+	return &Chain{middleware: append(middleware, fns...)}
+}
+
+// Extend returns a new chain with the middleware of c followed by the middleware of other.
+// Neither c nor other is changed.
+func (c *Chain) Extend(other *Chain) *Chain {
+	return c.Append(other.middleware...)
+}
+
+// handlersFor returns the handlers of the chain validated against the context type ctxType.
+// The returned slice can be modified by the caller.
+func (c *Chain) handlersFor(ctxType reflect.Type) []*middlewareHandler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	handlers, ok := c.handlers[ctxType]
+	if !ok {
+		for _, fn := range c.middleware {
+			handlers = append(handlers, middlewareHandlersFor(fn, ctxType)...)
+		}
+		if c.handlers == nil {
+			c.handlers = make(map[reflect.Type][]*middlewareHandler)
+		}
+		c.handlers[ctxType] = handlers
+	}
+	return append([]*middlewareHandler(nil), handlers...)
+}
@@ -0,0 +1,62 @@
+package grom
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mwGenericChain(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+	fmt.Fprintf(w, "generic-chain ")
+	next(w, r)
+}
+
+func TestChain(t *testing.T) {
+	base := NewChain(mwGenericChain)
+	root := base.Append((*Context).mwAlpha, (*Context).mwBeta)
+	admin := base.Extend(NewChain((*AdminContext).mwEpsilon))
+
+	router := New(Context{})
+	router.Middleware(root)
+	router.Get("/action", (*Context).A)
+	adminRouter := router.Subrouter(AdminContext{}, "/admin")
+	adminRouter.Middleware(admin)
+	adminRouter.Get("/action", (*AdminContext).B)
+	other := New(Context{}).Middleware(root.Append(When(func(r *Request) bool {
+		return r.URL.Query().Get("gamma") != ""
+	}, (*Context).mwGamma)))
+	other.Get("/action", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic-chain context-mw-Alpha context-mw-Beta context-A", 200)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic-chain context-mw-Alpha context-mw-Beta generic-chain admin-mw-Epsilon admin-B", 200)
+
+	rw, req = newTestRequest("GET", "/action?gamma=1")
+	other.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic-chain context-mw-Alpha context-mw-Beta context-mw-Gamma context-A", 200)
+
+	assert.Len(t, base.middleware, 1)
+	assert.Len(t, root.middleware, 3)
+}
+
+func TestChainValidatedOnce(t *testing.T) {
+	chain := NewChain(mwGenericChain, (*Context).mwAlpha)
+	ctxType := reflect.TypeOf(Context{})
+	first := chain.handlersFor(ctxType)
+	second := chain.handlersFor(ctxType)
+	assert.Equal(t, first, second)
+	assert.True(t, first[1] == second[1])
+
+	assert.Panics(t, func() {
+		New(AdminContext{}).Middleware(chain)
+	})
+	assert.Panics(t, func() {
+		New(Context{}).Middleware(NewChain(func() {}))
+	})
+}
@@ -0,0 +1,72 @@
+package grom
+
+import "reflect"
+
+// ConditionalMiddleware is middleware that only runs for some requests. See When.
+type ConditionalMiddleware struct {
+	predicate func(req *Request) bool
+	fn        interface{}
+}
+
+// When returns middleware that runs fn, which is anything Router.Middleware accepts,
+// only for requests for which predicate returns true. Other requests go straight to the next middleware.
+// The predicate is evaluated on each request. It can use RoutePath and PathParams in the middleware
+// of subrouters and in RoutedMiddleware, but not in root middleware that runs before routing.
+// Before a NotFound handler, IsRouted is false and RoutePath is empty.
+//
+//	router.Middleware(grom.When(func(req *grom.Request) bool {
+//		return req.Header.Get("Upgrade") == ""
+//	}, CompressMiddleware))
+func When(predicate func(req *Request) bool, fn interface{}) ConditionalMiddleware {
+	if predicate == nil {
+		panic("web: When needs a predicate")
+	}
+	return ConditionalMiddleware{predicate: predicate, fn: fn}
+}
+
+// MiddlewareExcept adds the specified middleware to the router, except for the given paths, and returns the router.
+// paths are relative to the router's path prefix, like the paths of routes. A path is skipped if it's
+// the request path or, once the request has been routed, the route's path, e.g. "/users/:id".
+// Like routes, paths match with or without a trailing slash.
+func (r *Router) MiddlewareExcept(fn interface{}, paths ...string) *Router {
+	except := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		except[cleanPath(appendPath(r.pathPrefix, path))] = true
+	}
+	return r.Middleware(When(func(req *Request) bool {
+		return !except[cleanPath(req.URL.Path)] && !except[req.RoutePath()]
+	}, fn))
+}
+
+// middlewareHandlersFor returns the handlers for fn, which is anything Router.Middleware accepts,
+// validated against the context type ctxType.
+func middlewareHandlersFor(fn interface{}, ctxType reflect.Type) []*middlewareHandler {
+	if cond, ok := fn.(ConditionalMiddleware); ok {
+		handlers := middlewareHandlersFor(cond.fn, ctxType)
+		for i, h := range handlers {
+			handlers[i] = h.when(cond.predicate)
+		}
+		return handlers
+	}
+	if chain, ok := fn.(*Chain); ok {
+		return chain.handlersFor(ctxType)
+	}
+
+	vfn := reflect.ValueOf(fn)
+	validateMiddleware(vfn, ctxType)
+	return []*middlewareHandler{middlewareHandlerFor(vfn)}
+}
+
+// when returns a handler that invokes mw if predicate returns true for the request, and calls next otherwise.
+func (mw *middlewareHandler) when(predicate func(req *Request) bool) *middlewareHandler {
+	return &middlewareHandler{
+		Name: mw.Name,
+		ContextMiddleware: func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			if !predicate(req) {
+				next(rw, req)
+				return nil
+			}
+			return mw.invoke(ctx, rw, req, next)
+		},
+	}
+}
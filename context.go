@@ -0,0 +1,190 @@
+package grom
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Contexts can opt in to the hooks below by declaring the corresponding methods on a pointer receiver.
+// Since a context embeds a pointer to its parent context, the parent's hooks are promoted to it.
+// Those promoted hooks are ignored, so each hook runs once, for the context that declares it.
+// Hooks promoted from other embedded fields are ignored too, so e.g. an embedded *sql.DB isn't closed after each request.
+
+var (
+	resetterType = reflect.TypeOf((*contextResetter)(nil)).Elem()
+	initerType   = reflect.TypeOf((*contextIniter)(nil)).Elem()
+	finisherType = reflect.TypeOf((*contextFinisher)(nil)).Elem()
+	closerType   = reflect.TypeOf((*contextCloser)(nil)).Elem()
+)
+
+// contextResetter is implemented by context types that can be reused across requests.
+// If *YourContext has a Reset() method, grom will call it once the response is complete
+// and hand the same struct to a later request instead of allocating a new one.
+// Reset must clear every field that shouldn't leak into the next request,
+// and middleware and handlers must not hold on to such a context after the request completes.
+type contextResetter interface {
+	Reset()
+}
+
+// contextIniter is implemented by context types that need per-request initialization.
+// If *YourContext has an Init(*Request) method, grom will call it on each new or reused context,
+// after its parent context has been set and before any middleware runs.
+type contextIniter interface {
+	Init(*Request)
+}
+
+// contextFinisher is implemented by context types that need cleanup once the response is complete.
+// If *YourContext has a Finish(ResponseWriter, *Request, interface{}) method, grom will call it
+// after the middleware stack has unwound and any panic has been handled.
+// panicked is the recovered value, or nil if the request didn't panic.
+type contextFinisher interface {
+	Finish(rw ResponseWriter, req *Request, panicked interface{})
+}
+
+// contextCloser is a simpler alternative to contextFinisher
+// for context types that don't care about the response or about panics.
+type contextCloser interface {
+	Close()
+}
+
+// contextHooks records which hooks a context type declares itself.
+type contextHooks struct {
+	reset  bool
+	init   bool
+	finish bool
+	close  bool
+}
+
+// hooksFor returns the hooks declared by ctxType.
+// parentField is the index of the field of ctxType that points to its parent context, or -1 if there is none.
+func hooksFor(ctxType reflect.Type, parentField int) contextHooks {
+	return contextHooks{
+		reset:  declaresMethod(ctxType, parentField, resetterType),
+		init:   declaresMethod(ctxType, parentField, initerType),
+		finish: declaresMethod(ctxType, parentField, finisherType),
+		close:  declaresMethod(ctxType, parentField, closerType),
+	}
+}
+
+// declaresMethod returns whether ctxType declares the method of iface itself, on a pointer receiver.
+// Methods promoted from the embedded parent context are ignored: the parent's router runs them.
+// So are methods that any other embedded field provides, at any depth, such as the Reset of an embedded
+// strings.Builder, which knows nothing about the other fields of ctxType. This holds even if ctxType
+// shadows the field's method with its own.
+func declaresMethod(ctxType reflect.Type, parentField int, iface reflect.Type) bool {
+	if !reflect.PtrTo(ctxType).Implements(iface) {
+		return false
+	}
+
+	for i := 0; i < ctxType.NumField(); i++ {
+		fld := ctxType.Field(i)
+		if !fld.Anonymous {
+			continue
+		}
+		if i == parentField {
+			// Methods promoted from an embedded *Parent are in the method set of ctxType itself,
+			// while methods declared on *ctxType are not.
+			if ctxType.Implements(iface) {
+				return false
+			}
+			continue
+		}
+		// The method set of the field's type includes what its own embedded fields provide, at any depth.
+		fldType := fld.Type
+		if fldType.Kind() != reflect.Ptr && fldType.Kind() != reflect.Interface {
+			fldType = reflect.PtrTo(fldType)
+		}
+		if fldType.Implements(iface) {
+			return false
+		}
+	}
+	return true
+}
+
+// setContextType sets the router's context type. r.parentField has to be set already.
+func (r *Router) setContextType(ctxType reflect.Type) {
+	r.contextType = ctxType
+	r.contextHooks = hooksFor(ctxType, r.parentField)
+	r.contextPool = nil
+	if r.contextHooks.reset {
+		r.contextPool = &sync.Pool{}
+	}
+}
+
+// newContext returns a pointer to a context of the router's context type for req.
+// The context is built by the router's context factory if there is one,
+// reused if its type can be reset, or allocated otherwise.
+// Its parent pointer is then set to parent (unless this is the root context),
+// services are injected and Init is called.
+func (r *Router) newContext(parent reflect.Value, req *Request) reflect.Value {
+	var ctx reflect.Value
+	switch {
+	case r.contextFactory != nil:
+		ctx = r.contextFactory(parent, req)
+	case r.contextPool != nil:
+		if c := r.contextPool.Get(); c != nil {
+			ctx = reflect.ValueOf(c)
+		} else {
+			ctx = reflect.New(r.contextType)
+		}
+	default:
+		ctx = reflect.New(r.contextType)
+	}
+
+	if parent.IsValid() {
+		reflect.Indirect(ctx).Field(r.parentField).Set(parent)
+	}
+
+	r.injectServices(ctx)
+
+	if r.contextHooks.init {
+		ctx.Interface().(contextIniter).Init(req)
+	}
+	return ctx
+}
+
+// releaseContext resets ctx and returns it to the router's pool, if the router pools its contexts.
+// If Reset panics, the panic is reported to the router's PanicHandler and ctx isn't reused.
+func (r *Router) releaseContext(ctx reflect.Value, req *Request) {
+	if r.contextPool == nil {
+		return
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			reportPanic(r, newPanicReport(req, recovered))
+		}
+	}()
+
+	c := ctx.Interface()
+	c.(contextResetter).Reset()
+	r.contextPool.Put(c)
+}
+
+// finishContexts calls Finish or Close on each context allocated for the request, starting with the innermost one.
+// A panic in one finalizer is reported to the router's PanicHandler and doesn't keep the others from running.
+func finishContexts(closure *middlewareClosure, rw ResponseWriter, req *Request, panicked interface{}) {
+	for i := len(closure.Contexts) - 1; i >= 0; i-- {
+		if closure.allocatedContext(i) {
+			closure.Routers[i].finishContext(closure.Contexts[i], rw, req, panicked)
+		}
+	}
+}
+
+func (r *Router) finishContext(ctx reflect.Value, rw ResponseWriter, req *Request, panicked interface{}) {
+	if !r.contextHooks.finish && !r.contextHooks.close {
+		return
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			reportPanic(r, newPanicReport(req, recovered))
+		}
+	}()
+
+	if r.contextHooks.finish {
+		ctx.Interface().(contextFinisher).Finish(rw, req, panicked)
+	} else {
+		ctx.Interface().(contextCloser).Close()
+	}
+}
@@ -0,0 +1,124 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TaggedParentContext struct {
+	Name   string
+	Other  *Context
+	Parent *Context `grom:"parent"`
+}
+
+type LaterParentContext struct {
+	Name   string
+	Parent *AdminContext
+}
+
+type SkipLevelContext struct {
+	Root *Context
+	Name string
+}
+
+func (c *SkipLevelContext) ErrorHandler(rw ResponseWriter, req *Request, err interface{}) {
+	rw.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(rw, "skip-level error root=%t", c.Root != nil)
+}
+
+type unexportedParentContext struct {
+	parent *Context
+}
+
+func TestTaggedParentContext(t *testing.T) {
+	router := New(Context{})
+	router.Middleware((*Context).mwAlpha)
+	sub := router.Subrouter(TaggedParentContext{}, "/tagged")
+	sub.Get("/action", func(c *TaggedParentContext, rw ResponseWriter, req *Request) {
+		fmt.Fprintf(rw, "parent=%t other=%t", c.Parent != nil, c.Other != nil)
+	})
+
+	rw, req := newTestRequest("GET", "/tagged/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-mw-Alpha parent=true other=false", http.StatusOK)
+}
+
+func TestLaterParentField(t *testing.T) {
+	router := New(Context{})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Middleware((*AdminContext).mwEpsilon)
+	sub := admin.Subrouter(LaterParentContext{}, "/later")
+	sub.Get("/action", func(c *LaterParentContext, rw ResponseWriter, req *Request) {
+		fmt.Fprintf(rw, "parent=%t root=%t", c.Parent != nil, c.Parent.Context != nil)
+	})
+
+	rw, req := newTestRequest("GET", "/admin/later/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "admin-mw-Epsilon parent=true root=true", http.StatusOK)
+}
+
+func TestSkipLevelContext(t *testing.T) {
+	var root *Context
+	router := New(Context{})
+	router.Middleware(func(c *Context, rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		root = c
+		next(rw, req)
+	})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Middleware((*AdminContext).mwEpsilon)
+	admin.Error((*AdminContext).ErrorHandler)
+
+	// The same context type is used directly below the root, and below the admin router.
+	for _, parent := range []*Router{router, admin} {
+		sub := parent.Subrouter(SkipLevelContext{}, "/skip")
+		sub.Get("/action", func(c *SkipLevelContext, rw ResponseWriter, req *Request) {
+			fmt.Fprintf(rw, "root=%t", c.Root == root)
+		})
+	}
+
+	rw, req := newTestRequest("GET", "/skip/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root=true", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/skip/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "admin-mw-Epsilon root=true", http.StatusOK)
+}
+
+func TestSkipLevelErrorHandlers(t *testing.T) {
+	router := New(Context{})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Error((*AdminContext).ErrorHandler)
+	skip := admin.Subrouter(SkipLevelContext{}, "/skip")
+	skip.Get("/action", func(c *SkipLevelContext, rw ResponseWriter, req *Request) {
+		panic("boom")
+	})
+	tickets := skip.Subrouter(TicketsContext{}, "/tickets")
+	tickets.Get("/action", (*TicketsContext).ErrorAction)
+
+	// No handler on the skip router: the admin router's handler gets the admin context.
+	rw, req := newTestRequest("GET", "/admin/skip/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Admin Error", http.StatusInternalServerError)
+
+	skip.Error((*SkipLevelContext).ErrorHandler)
+	rw, req = newTestRequest("GET", "/admin/skip/tickets/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "skip-level error root=true", http.StatusInternalServerError)
+}
+
+func TestInvalidParentField(t *testing.T) {
+	router := New(Context{})
+	assert.Panics(t, func() {
+		router.Subrouter(unexportedParentContext{}, "/")
+	})
+
+	assert.Panics(t, func() {
+		router.Subrouter(struct {
+			Parent *AdminContext `grom:"parent"`
+		}{}, "/")
+	})
+}
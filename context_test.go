@@ -0,0 +1,243 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type FactoryContext struct {
+	Tenant string
+}
+
+type FactoryAdminContext struct {
+	*FactoryContext
+	Greeting string
+}
+
+func (c *FactoryAdminContext) Action(rw ResponseWriter, req *Request) {
+	fmt.Fprintf(rw, "%s %s", c.Greeting, c.Tenant)
+}
+
+type InitContext struct {
+	Path string
+}
+
+func (c *InitContext) Init(req *Request) {
+	c.Path = req.URL.Path
+}
+
+type InitAdminContext struct {
+	*InitContext
+	Parent string
+}
+
+func (c *InitAdminContext) Init(req *Request) {
+	c.Parent = c.InitContext.Path
+}
+
+func TestContextFactory(t *testing.T) {
+	router := New(FactoryContext{})
+	router.ContextFactory(func(req *Request) *FactoryContext {
+		return &FactoryContext{Tenant: req.Header.Get("X-Tenant")}
+	})
+	admin := router.Subrouter(FactoryAdminContext{}, "/admin")
+	admin.ContextFactory(func(parent *FactoryContext, req *Request) *FactoryAdminContext {
+		return &FactoryAdminContext{Greeting: "hello"}
+	})
+	admin.Get("/action", (*FactoryAdminContext).Action)
+
+	rw, req := newTestRequest("GET", "/admin/action")
+	req.Header.Set("X-Tenant", "acme")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "hello acme", http.StatusOK)
+}
+
+func TestContextInit(t *testing.T) {
+	router := New(InitContext{})
+	router.Get("/action", func(c *InitContext, rw ResponseWriter, req *Request) {
+		fmt.Fprint(rw, c.Path)
+	})
+	admin := router.Subrouter(InitAdminContext{}, "/admin")
+	admin.Get("/action", func(c *InitAdminContext, rw ResponseWriter, req *Request) {
+		fmt.Fprint(rw, "parent ", c.Parent)
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "/action", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "parent /admin/action", http.StatusOK)
+}
+
+type InitTicketsContext struct {
+	*InitContext
+	Ticket string
+}
+
+func TestPromotedInitIgnored(t *testing.T) {
+	var paths []string
+	router := New(InitContext{})
+	router.Middleware(func(c *InitContext, rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		c.Path = "changed by middleware"
+		next(rw, req)
+	})
+	tickets := router.Subrouter(InitTicketsContext{}, "/tickets")
+	tickets.Get("/action", func(c *InitTicketsContext, rw ResponseWriter, req *Request) {
+		paths = append(paths, c.Path)
+	})
+
+	rw, req := newTestRequest("GET", "/tickets/action")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, []string{"changed by middleware"}, paths)
+}
+
+func TestContextFactoryPanic(t *testing.T) {
+	router := New(Context{})
+	router.ContextFactory(func(req *Request) *Context {
+		return nil
+	})
+	router.Error((*Context).ErrorHandler)
+	router.Get("/action", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "My Error", http.StatusInternalServerError)
+}
+
+func TestInvalidContextFactory(t *testing.T) {
+	router := New(FactoryContext{})
+	assert.Panics(t, func() {
+		router.ContextFactory(func(parent *Context, req *Request) *FactoryContext { return nil })
+	})
+
+	assert.Panics(t, func() {
+		router.ContextFactory(func(req *Request) *Context { return nil })
+	})
+
+	admin := router.Subrouter(FactoryAdminContext{}, "/admin")
+	assert.Panics(t, func() {
+		admin.ContextFactory(func(req *Request) *FactoryAdminContext { return nil })
+	})
+
+	same := router.Subrouter(FactoryContext{}, "/same")
+	assert.Panics(t, func() {
+		same.ContextFactory(func(parent *FactoryContext, req *Request) *FactoryContext { return nil })
+	})
+}
+
+type FinishContext struct {
+	Log *[]string
+}
+
+func (c *FinishContext) Init(req *Request) {
+	c.Log = &[]string{}
+	finishLogs = append(finishLogs, c.Log)
+}
+
+func (c *FinishContext) Finish(rw ResponseWriter, req *Request, panicked interface{}) {
+	*c.Log = append(*c.Log, fmt.Sprintf("root %d %v", rw.StatusCode(), panicked))
+}
+
+type CloseContext struct {
+	*FinishContext
+}
+
+func (c *CloseContext) Close() {
+	*c.Log = append(*c.Log, "admin")
+}
+
+func (c *CloseContext) Action(rw ResponseWriter, req *Request) {
+	*c.Log = append(*c.Log, "action")
+}
+
+func (c *CloseContext) ErrorAction(rw ResponseWriter, req *Request) {
+	panic("boom")
+}
+
+var finishLogs []*[]string
+
+func TestContextFinalizers(t *testing.T) {
+	finishLogs = nil
+	router := New(FinishContext{})
+	admin := router.Subrouter(CloseContext{}, "/admin")
+	admin.Get("/action", (*CloseContext).Action)
+	admin.Get("/error", (*CloseContext).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, []string{"action", "admin", "root 0 <nil>"}, *finishLogs[0])
+
+	rw, req = newTestRequest("GET", "/admin/error")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+	assert.Equal(t, []string{"admin", "root 500 boom"}, *finishLogs[1])
+}
+
+// sharedConn stands in for a connection pool that outlives requests, e.g. a *sql.DB.
+type sharedConn struct {
+	closed   int
+	finished int
+}
+
+func (c *sharedConn) Close() {
+	c.closed++
+}
+
+func (c *sharedConn) Finish(rw ResponseWriter, req *Request, panicked interface{}) {
+	c.finished++
+}
+
+type ConnContext struct {
+	*sharedConn
+}
+
+type ConnValueContext struct {
+	sharedConn
+}
+
+func TestEmbeddedFinalizersIgnored(t *testing.T) {
+	conn := &sharedConn{}
+	router := New(ConnContext{})
+	router.ContextFactory(func(req *Request) *ConnContext {
+		return &ConnContext{sharedConn: conn}
+	})
+	router.Get("/action", func(c *ConnContext, rw ResponseWriter, req *Request) {
+		fmt.Fprint(rw, "ok")
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "ok", http.StatusOK)
+	assert.Equal(t, 0, conn.closed)
+	assert.Equal(t, 0, conn.finished)
+
+	valueRouter := New(ConnValueContext{})
+	assert.Equal(t, contextHooks{}, valueRouter.contextHooks)
+}
+
+type PanickingFinishContext struct {
+	*FinishContext
+}
+
+func (c *PanickingFinishContext) Close() {
+	panic("close")
+}
+
+func TestContextFinalizerPanic(t *testing.T) {
+	finishLogs = nil
+	router := New(FinishContext{})
+	admin := router.Subrouter(PanickingFinishContext{}, "/admin")
+	admin.Get("/action", func(rw ResponseWriter, req *Request) {
+		fmt.Fprint(rw, "ok")
+	})
+
+	rw, req := newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "ok", http.StatusOK)
+	assert.Equal(t, []string{"root 200 <nil>"}, *finishLogs[0])
+}
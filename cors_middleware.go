@@ -0,0 +1,140 @@
+package grom
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOption configures CORSMiddleware.
+type CORSOption struct {
+	// AllowedOrigins are the origins that can make cross-origin requests, e.g. "https://example.com".
+	// "*" allows any origin, and a single "*" in an origin matches any part of it, e.g. "https://*.example.com".
+	AllowedOrigins []string
+	// AllowOriginFunc, if set, is asked about origins that don't match AllowedOrigins.
+	AllowOriginFunc func(origin string, req *Request) bool
+	// AllowedMethods are the methods a preflight request can ask for.
+	// If empty, the methods that have a route for the path are allowed, as found by the automatic OPTIONS handling.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers a preflight request can ask for. Matching is case-insensitive.
+	// If empty, or if it contains "*", the requested headers are echoed back.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that scripts can read.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies and HTTP authentication.
+	// The origin is then echoed back even if any origin is allowed.
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request can be cached. It's not sent if zero.
+	MaxAge time.Duration
+	// AllowPrivateNetwork answers Private Network Access preflight requests
+	// from public websites to servers on a private network.
+	AllowPrivateNetwork bool
+}
+
+// CORSMiddleware returns a middleware that handles Cross-Origin Resource Sharing (CORS) requests.
+// Preflight requests are passed on to the OPTIONS handling of the router,
+// so add it to a router that has routes (or the root router) rather than answering them itself.
+// Requests from origins that aren't allowed are passed on without any CORS headers, so browsers reject them.
+func CORSMiddleware(option CORSOption) func(ResponseWriter, *Request, NextMiddlewareFunc) {
+	allowedHeaders := make(map[string]bool, len(option.AllowedHeaders))
+	echoHeaders := len(option.AllowedHeaders) == 0
+	for _, header := range option.AllowedHeaders {
+		if header == "*" {
+			echoHeaders = true
+		}
+		allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	anyOrigin := false
+	for _, origin := range option.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+	}
+	allowedMethods := strings.Join(option.AllowedMethods, ", ")
+	exposedHeaders := strings.Join(option.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(option.MaxAge / time.Second))
+
+	return func(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			next(rw, req)
+			return
+		}
+
+		header := rw.Header()
+		preflight := req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != ""
+		header.Add("Vary", "Origin")
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !option.allowsOrigin(origin, req) {
+			next(rw, req)
+			return
+		}
+
+		if anyOrigin && !option.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if option.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			next(rw, req)
+			return
+		}
+
+		if allowedMethods != "" {
+			header.Set("Access-Control-Allow-Methods", allowedMethods)
+		}
+		if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			if echoHeaders || headersAllowed(requested, allowedHeaders) {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+		}
+		if option.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		if option.AllowPrivateNetwork && req.Header.Get("Access-Control-Request-Private-Network") == "true" {
+			header.Set("Access-Control-Allow-Private-Network", "true")
+		}
+		next(rw, req)
+	}
+}
+
+func (option *CORSOption) allowsOrigin(origin string, req *Request) bool {
+	for _, allowed := range option.AllowedOrigins {
+		if originMatches(strings.ToLower(allowed), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return option.AllowOriginFunc != nil && option.AllowOriginFunc(origin, req)
+}
+
+// originMatches returns true if origin matches pattern, which can contain one "*".
+func originMatches(pattern, origin string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:star], pattern[star+1:]
+	return len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+// headersAllowed returns true if all the headers in the comma-separated list requested are allowed.
+func headersAllowed(requested string, allowed map[string]bool) bool {
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !allowed[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
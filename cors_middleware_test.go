@@ -0,0 +1,111 @@
+package grom
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func corsRouter(option CORSOption) *Router {
+	router := New(Context{})
+	router.Middleware(CORSMiddleware(option))
+	router.Get("/users/:id", func(rw ResponseWriter, req *Request) {
+		rw.Header().Set("X-Total", "1")
+	})
+	router.Put("/users/:id", (*Context).A)
+	return router
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := corsRouter(CORSOption{
+		AllowedOrigins:      []string{"https://*.example.com"},
+		AllowCredentials:    true,
+		MaxAge:              10 * time.Minute,
+		AllowPrivateNetwork: true,
+	})
+
+	rw, req := newTestRequest("OPTIONS", "/users/3")
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, X-Token")
+	req.Header.Set("Access-Control-Request-Private-Network", "true")
+	router.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "https://app.example.com", rw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rw.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, PUT", rw.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-Token", rw.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rw.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "true", rw.Header().Get("Access-Control-Allow-Private-Network"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, rw.Header().Values("Vary"))
+}
+
+func TestCORSPreflightRestrictions(t *testing.T) {
+	router := corsRouter(CORSOption{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET"},
+		AllowedHeaders: []string{"content-type"},
+	})
+
+	rw, req := newTestRequest("OPTIONS", "/users/3")
+	req.Header.Set("Origin", "https://anywhere.test")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "*", rw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, []string{"GET"}, rw.Header().Values("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type", rw.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "", rw.Header().Get("Access-Control-Max-Age"))
+
+	rw, req = newTestRequest("OPTIONS", "/users/3")
+	req.Header.Set("Origin", "https://anywhere.test")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, X-Token")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Headers"))
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	router := corsRouter(CORSOption{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowOriginFunc: func(origin string, req *Request) bool {
+			return strings.HasSuffix(origin, ".internal")
+		},
+		ExposedHeaders: []string{"X-Total"},
+	})
+
+	for _, origin := range []string{"https://example.com", "HTTPS://EXAMPLE.COM", "http://tools.internal"} {
+		rw, req := newTestRequest("GET", "/users/3")
+		req.Header.Set("Origin", origin)
+		router.ServeHTTP(rw, req)
+		assert.Equal(t, origin, rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Total", rw.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "1", rw.Header().Get("X-Total"))
+	}
+
+	rw, req := newTestRequest("GET", "/users/3")
+	req.Header.Set("Origin", "https://evil.test")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", rw.Header().Get("Vary"))
+
+	rw, req = newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", rw.Header().Get("Vary"))
+}
+
+func TestOriginMatches(t *testing.T) {
+	assert.True(t, originMatches("*", "https://a.test"))
+	assert.True(t, originMatches("https://*.example.com", "https://a.b.example.com"))
+	assert.False(t, originMatches("https://*.example.com", "https://example.com"))
+	assert.False(t, originMatches("https://*.example.com", "https://example.com.evil.test"))
+	assert.True(t, originMatches("http://localhost:*", "http://localhost:3000"))
+	assert.False(t, originMatches("https://example.com", "https://example.com.evil.test"))
+}
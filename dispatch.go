@@ -0,0 +1,201 @@
+package grom
+
+import (
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// The functions in this file turn handlers and middleware that were validated with reflection
+// into plain Go closures once, at registration time, so requests don't go through reflect.Value.Call.
+//
+// A handler that takes a *ctxType as its first argument has the same calling convention as one that
+// takes an unsafe.Pointer, since both are a single pointer. That lets us reinterpret the validated
+// function value as a function of a known shape and call it directly with the context pointer.
+//
+// This is the one place grom uses unsafe, and it's deliberate: the context type is only known at run time,
+// so the safe alternatives all go through reflection on every call. reflect.Value.Call allocates its
+// arguments and is several times slower (compare BenchmarkGrom_ContextDispatch and BenchmarkGrom_ReflectDispatch),
+// and reflect.MakeFunc builds functions to be called, not callers of an arbitrary function.
+// The reinterpretation is sound because castFunc only swaps pointer types for unsafe.Pointer,
+// which the garbage collector scans the same way, and the pointer a handler is called with
+// is always a *ctxType from the request's contexts. TestUnsafeDispatch pins this down; run it with
+// -race, which also turns on the compiler's pointer conversion checks (checkptr).
+// Code that wants the same speed without unsafe can use a TypedRouter.
+
+var (
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+	unsafePointerType = reflect.TypeOf(unsafe.Pointer(nil))
+)
+
+type (
+	unsafeContextHandler         func(unsafe.Pointer, ResponseWriter, *Request)
+	unsafeContextErrorHandler    func(unsafe.Pointer, ResponseWriter, *Request) error
+	unsafeContextMiddleware      func(unsafe.Pointer, ResponseWriter, *Request, NextMiddlewareFunc)
+	unsafeContextErrorMiddleware func(unsafe.Pointer, ResponseWriter, *Request, NextMiddlewareFunc) error
+	unsafeRootContextFactory     func(*Request) unsafe.Pointer
+	unsafeContextFactory         func(unsafe.Pointer, *Request) unsafe.Pointer
+	contextHandlerFunc           func(ctx reflect.Value, rw ResponseWriter, req *Request) error
+	contextMiddlewareFunc        func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error
+)
+
+// actionHandlerFor returns the actionHandler for the validated handler vfn.
+func actionHandlerFor(vfn reflect.Value) *actionHandler {
+	if fnType := vfn.Type(); fnType.NumIn() == 2 && fnType.NumOut() == 0 {
+		return &actionHandler{Name: funcName(vfn), Generic: true, GenericHandler: convertFunc[GenericHandler](vfn)}
+	}
+	return &actionHandler{Name: funcName(vfn), Generic: false, DynamicHandler: vfn, ContextHandler: contextHandlerFor(vfn)}
+}
+
+// middlewareHandlerFor returns the middlewareHandler for the validated middleware vfn.
+func middlewareHandlerFor(vfn reflect.Value) *middlewareHandler {
+	if fnType := vfn.Type(); fnType.NumIn() == 3 && fnType.NumOut() == 0 {
+		return &middlewareHandler{Name: funcName(vfn), Generic: true, GenericMiddleware: convertFunc[GenericMiddleware](vfn)}
+	}
+	return &middlewareHandler{Name: funcName(vfn), Generic: false, DynamicMiddleware: vfn, ContextMiddleware: contextMiddlewareFor(vfn)}
+}
+
+// contextHandlerFor returns a closure that invokes the validated handler vfn,
+// which accepts a context, returns an error, or both.
+func contextHandlerFor(vfn reflect.Value) contextHandlerFunc {
+	fnType := vfn.Type()
+	returnsError := fnType.NumOut() == 1
+	switch {
+	case fnType.NumIn() == 2:
+		fn := convertFunc[func(ResponseWriter, *Request) error](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+			return fn(rw, req)
+		}
+	case fnType.In(0) == emptyInterfaceType && returnsError:
+		fn := convertFunc[func(interface{}, ResponseWriter, *Request) error](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+			return fn(ctx.Interface(), rw, req)
+		}
+	case fnType.In(0) == emptyInterfaceType:
+		fn := convertFunc[func(interface{}, ResponseWriter, *Request)](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+			fn(ctx.Interface(), rw, req)
+			return nil
+		}
+	case returnsError:
+		f := castFunc[unsafeContextErrorHandler](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+			return f(ctx.UnsafePointer(), rw, req)
+		}
+	default:
+		f := castFunc[unsafeContextHandler](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+			f(ctx.UnsafePointer(), rw, req)
+			return nil
+		}
+	}
+}
+
+// contextMiddlewareFor returns a closure that invokes the validated middleware vfn,
+// which accepts a context, returns an error, or both.
+func contextMiddlewareFor(vfn reflect.Value) contextMiddlewareFunc {
+	fnType := vfn.Type()
+	returnsError := fnType.NumOut() == 1
+	switch {
+	case fnType.NumIn() == 3:
+		fn := convertFunc[func(ResponseWriter, *Request, NextMiddlewareFunc) error](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			return fn(rw, req, next)
+		}
+	case fnType.In(0) == emptyInterfaceType && returnsError:
+		fn := convertFunc[func(interface{}, ResponseWriter, *Request, NextMiddlewareFunc) error](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			return fn(ctx.Interface(), rw, req, next)
+		}
+	case fnType.In(0) == emptyInterfaceType:
+		fn := convertFunc[func(interface{}, ResponseWriter, *Request, NextMiddlewareFunc)](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			fn(ctx.Interface(), rw, req, next)
+			return nil
+		}
+	case returnsError:
+		f := castFunc[unsafeContextErrorMiddleware](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			return f(ctx.UnsafePointer(), rw, req, next)
+		}
+	default:
+		f := castFunc[unsafeContextMiddleware](vfn)
+		return func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			f(ctx.UnsafePointer(), rw, req, next)
+			return nil
+		}
+	}
+}
+
+// contextFactoryFor returns a closure that invokes the validated context factory vfn,
+// which builds contexts of type ctxType.
+func contextFactoryFor(vfn reflect.Value, ctxType reflect.Type) func(parent reflect.Value, req *Request) reflect.Value {
+	if vfn.Type().NumIn() == 1 {
+		f := castFunc[unsafeRootContextFactory](vfn)
+		return func(parent reflect.Value, req *Request) reflect.Value {
+			return contextAt(ctxType, f(req))
+		}
+	}
+
+	f := castFunc[unsafeContextFactory](vfn)
+	return func(parent reflect.Value, req *Request) reflect.Value {
+		return contextAt(ctxType, f(parent.UnsafePointer(), req))
+	}
+}
+
+func contextAt(ctxType reflect.Type, p unsafe.Pointer) reflect.Value {
+	if p == nil {
+		panic("web: ContextFactory returned a nil context")
+	}
+	return reflect.NewAt(ctxType, p)
+}
+
+// convertFunc converts the function value vfn to the function type F, which has the same signature.
+func convertFunc[F any](vfn reflect.Value) F {
+	var fn F
+	return vfn.Convert(reflect.TypeOf(fn)).Interface().(F)
+}
+
+// funcName returns the name of the function vfn, e.g. "github.com/pchchv/grom.(*Context).A", or "" if it's unknown.
+func funcName(vfn reflect.Value) string {
+	if f := runtime.FuncForPC(vfn.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// castFunc reinterprets the validated function vfn as the function type F, which has the same signature
+// except that F has unsafe.Pointer where vfn has a pointer type. It panics if the shapes don't line up.
+func castFunc[F any](vfn reflect.Value) F {
+	var fn F
+	if !sameShape(vfn.Type(), reflect.TypeOf(fn)) {
+		panic("web: can't dispatch " + vfn.Type().String() + " as " + reflect.TypeOf(fn).String())
+	}
+
+	p := reflect.New(vfn.Type())
+	p.Elem().Set(vfn)
+	return *(*F)(p.UnsafePointer())
+}
+
+// sameShape returns whether the function types fnType and shape only differ in pointer types
+// that are unsafe.Pointer in shape.
+func sameShape(fnType, shape reflect.Type) bool {
+	if fnType.Kind() != reflect.Func || fnType.IsVariadic() || fnType.NumIn() != shape.NumIn() || fnType.NumOut() != shape.NumOut() {
+		return false
+	}
+
+	same := func(t, s reflect.Type) bool {
+		return t == s || s == unsafePointerType && t.Kind() == reflect.Pointer
+	}
+	for i := 0; i < fnType.NumIn(); i++ {
+		if !same(fnType.In(i), shape.In(i)) {
+			return false
+		}
+	}
+	for i := 0; i < fnType.NumOut(); i++ {
+		if !same(fnType.Out(i), shape.Out(i)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func handlerGenericInterface(ctx interface{}, w ResponseWriter, r *Request) {
+	fmt.Fprintf(w, "interface-%T", ctx)
+}
+
+func TestContextHandlerFor(t *testing.T) {
+	ctx := reflect.New(reflect.TypeOf(BenchContext{}))
+	ctx.Interface().(*BenchContext).MyField = "field"
+	rw := &appResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	req := &Request{}
+
+	var got string
+	h := contextHandlerFor(reflect.ValueOf(func(c *BenchContext, w ResponseWriter, r *Request) {
+		got = c.MyField
+	}))
+	h(ctx, rw, req)
+	assert.Equal(t, "field", got)
+
+	mw := contextMiddlewareFor(reflect.ValueOf(func(c *BenchContext, w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		c.MyField = "middleware"
+		next(w, r)
+	}))
+	mw(ctx, rw, req, func(w ResponseWriter, r *Request) {})
+	assert.Equal(t, "middleware", ctx.Interface().(*BenchContext).MyField)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		h(ctx, rw, req)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestInterfaceHandler(t *testing.T) {
+	router := New(Context{})
+	router.Get("/action", handlerGenericInterface)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "interface-*grom.Context", http.StatusOK)
+}
+
+type namedErrorHandler func(w ResponseWriter, r *Request) error
+
+type namedContextErrorHandler func(c *BenchContext, w ResponseWriter, r *Request) error
+
+func TestContextHandlerForNamedTypes(t *testing.T) {
+	ctx := reflect.New(reflect.TypeOf(BenchContext{}))
+	ctx.Interface().(*BenchContext).MyField = "field"
+	rw := &appResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	req := &Request{}
+
+	h := contextHandlerFor(reflect.ValueOf(namedErrorHandler(func(w ResponseWriter, r *Request) error {
+		return fmt.Errorf("generic")
+	})))
+	assert.EqualError(t, h(ctx, rw, req), "generic")
+
+	h = contextHandlerFor(reflect.ValueOf(namedContextErrorHandler(func(c *BenchContext, w ResponseWriter, r *Request) error {
+		return fmt.Errorf("context-%s", c.MyField)
+	})))
+	assert.EqualError(t, h(ctx, rw, req), "context-field")
+}
+
+// TestUnsafeDispatch covers each function shape that is dispatched through castFunc, with garbage
+// collections while the contexts are only referenced by the reinterpreted pointers.
+// Run it with -race to also have checkptr validate the pointer conversions.
+func TestUnsafeDispatch(t *testing.T) {
+	router := New(BenchContext{})
+	router.ContextFactory(func(req *Request) *BenchContext {
+		runtime.GC()
+		return &BenchContext{MyField: "root"}
+	})
+	router.Middleware(func(c *BenchContext, w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		runtime.GC()
+		c.MyField += "-mw"
+		next(w, r)
+	})
+	router.Middleware(func(c *BenchContext, w ResponseWriter, r *Request, next NextMiddlewareFunc) error {
+		runtime.GC()
+		c.MyField += "-errmw"
+		next(w, r)
+		return nil
+	})
+	router.Get("/action", func(c *BenchContext, w ResponseWriter, r *Request) {
+		runtime.GC()
+		fmt.Fprint(w, c.MyField)
+	})
+	router.Get("/error", func(c *BenchContext, w ResponseWriter, r *Request) error {
+		runtime.GC()
+		return fmt.Errorf("%s", c.MyField)
+	})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		fmt.Fprint(w, err)
+	})
+	sub := router.Subrouter(BenchContextB{}, "/sub")
+	sub.ContextFactory(func(parent *BenchContext, req *Request) *BenchContextB {
+		runtime.GC()
+		parent.MyField += "-sub"
+		return &BenchContextB{}
+	})
+	sub.Get("/action", func(c *BenchContextB, w ResponseWriter, r *Request) {
+		fmt.Fprint(w, c.MyField)
+	})
+
+	for i := 0; i < 10; i++ {
+		rw, req := newTestRequest("GET", "/action")
+		router.ServeHTTP(rw, req)
+		assertResponse(t, rw, "root-mw-errmw", http.StatusOK)
+
+		rw, req = newTestRequest("GET", "/error")
+		router.ServeHTTP(rw, req)
+		assertResponse(t, rw, "root-mw-errmw", http.StatusOK)
+
+		rw, req = newTestRequest("GET", "/sub/action")
+		router.ServeHTTP(rw, req)
+		assertResponse(t, rw, "root-mw-errmw-sub", http.StatusOK)
+	}
+}
+
+func TestCastFuncShapes(t *testing.T) {
+	assert.Panics(t, func() {
+		castFunc[unsafeContextHandler](reflect.ValueOf(func(c BenchContext, w ResponseWriter, r *Request) {}))
+	})
+	assert.Panics(t, func() {
+		castFunc[unsafeContextHandler](reflect.ValueOf(func(c *BenchContext, w ResponseWriter, r *Request) error { return nil }))
+	})
+	assert.NotPanics(t, func() {
+		castFunc[unsafeContextErrorHandler](reflect.ValueOf(func(c *BenchContext, w ResponseWriter, r *Request) error { return nil }))
+	})
+}
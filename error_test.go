@@ -2,6 +2,7 @@ package grom
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -172,3 +173,331 @@ func TestPanicLogging(t *testing.T) {
 		t.Error("Expected to have our PanicHandler be logged to.")
 	}
 }
+
+type recordingPanicReporter struct {
+	panics *[]interface{}
+}
+
+func (r recordingPanicReporter) Panic(url string, err interface{}, stack string) {
+	*r.panics = append(*r.panics, err)
+}
+
+func TestHandlerReturnsError(t *testing.T) {
+	var panics []interface{}
+	oldHandler := PanicHandler
+	PanicHandler = recordingPanicReporter{panics: &panics}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	var handled interface{}
+	router := New(Context{})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		handled = err
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Returned Error")
+	})
+	router.Get("/action", func(c *Context, w ResponseWriter, r *Request) error {
+		return errors.New("boom")
+	})
+	router.Get("/ok", func(w ResponseWriter, r *Request) error {
+		fmt.Fprintf(w, "ok")
+		return nil
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Returned Error", http.StatusInternalServerError)
+	assert.EqualError(t, handled.(error), "boom")
+
+	rw, req = newTestRequest("GET", "/ok")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "ok", http.StatusOK)
+
+	assert.Empty(t, panics)
+}
+
+func TestHandlerReturnsErrorWithoutErrorHandler(t *testing.T) {
+	var reports []*PanicReport
+	router := New(Context{}).PanicHandler(recordingStructuredReporter{reports: &reports})
+	router.Get("/action", func(w ResponseWriter, r *Request) error {
+		return errors.New("boom")
+	})
+	router.Get("/missing", func(w ResponseWriter, r *Request) error {
+		return NotFound("no such thing")
+	})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Middleware(func(w ResponseWriter, r *Request, next NextMiddlewareFunc) error {
+		return errors.New("denied")
+	})
+	admin.Get("/action", func(w ResponseWriter, r *Request) {})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+
+	// Client errors aren't reported.
+	rw, req = newTestRequest("GET", "/missing")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "no such thing", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+
+	if assert.Len(t, reports, 2) {
+		assert.EqualError(t, reports[0].Value.(error), "boom")
+		assert.Equal(t, "/action", reports[0].RoutePath)
+		assert.Empty(t, reports[0].Stack)
+		assert.Empty(t, reports[0].Frames)
+		assert.EqualError(t, reports[1].Value.(error), "denied")
+		assert.Equal(t, "/admin/action", reports[1].RoutePath)
+	}
+}
+
+func TestSubrouterHandlerReturnsError(t *testing.T) {
+	router := New(Context{})
+	router.Error((*Context).ErrorHandler)
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Get("/action", func(c *AdminContext, w ResponseWriter, r *Request) error {
+		return errors.New("boom")
+	})
+	api := router.Subrouter(APIContext{}, "/api")
+	api.Error((*APIContext).ErrorHandler)
+	api.Get("/action", func(c interface{}, w ResponseWriter, r *Request) error {
+		return errors.New("boom")
+	})
+
+	rw, req := newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "My Error", http.StatusInternalServerError)
+
+	rw, req = newTestRequest("GET", "/api/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Api Error", http.StatusInternalServerError)
+}
+
+func TestMiddlewareReturnsError(t *testing.T) {
+	var trace []string
+	router := New(Context{})
+	router.Error((*Context).ErrorHandler)
+	router.Middleware(func(w ResponseWriter, r *Request, next NextMiddlewareFunc) error {
+		next(w, r)
+		trace = append(trace, "root after next")
+		return nil
+	})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Error((*AdminContext).ErrorHandler)
+	admin.Middleware(func(c *AdminContext, w ResponseWriter, r *Request, next NextMiddlewareFunc) error {
+		return errors.New("denied")
+	})
+	admin.Get("/action", func(c *AdminContext, w ResponseWriter, r *Request) {
+		trace = append(trace, "action")
+	})
+
+	rw, req := newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Admin Error", http.StatusInternalServerError)
+	assert.Equal(t, []string{"root after next"}, trace)
+}
+
+func TestRootMiddlewareReturnsError(t *testing.T) {
+	router := New(Context{})
+	router.Error((*Context).ErrorHandler)
+	router.Middleware(func(c interface{}, w ResponseWriter, r *Request, next NextMiddlewareFunc) error {
+		return errors.New("denied")
+	})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Error((*AdminContext).ErrorHandler)
+	admin.Get("/action", (*AdminContext).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "My Error", http.StatusInternalServerError)
+}
+
+var errUnknownUser = errors.New("unknown user")
+
+func TestErrorHandlerReraise(t *testing.T) {
+	router := New(Context{})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "App Error: %v", err)
+	})
+	api := router.Subrouter(APIContext{}, "/api")
+	api.Error(func(c *APIContext, w ResponseWriter, r *Request, err interface{}) error {
+		if err == errUnknownUser {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Api Error")
+			return nil
+		}
+		return fmt.Errorf("api: %v", err)
+	})
+	api.Get("/users", func(w ResponseWriter, r *Request) error {
+		return errUnknownUser
+	})
+	api.Get("/boom", (*APIContext).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/api/users")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Api Error", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/api/boom")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "App Error: api: runtime error: integer divide by zero", http.StatusInternalServerError)
+}
+
+func TestErrorHandlerReraiseWithoutParentHandler(t *testing.T) {
+	router := New(Context{})
+	api := router.Subrouter(APIContext{}, "/api")
+	api.Error(func(w ResponseWriter, r *Request, err interface{}) error {
+		return Forbidden("declined")
+	})
+	api.Get("/boom", (*APIContext).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/api/boom")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "declined", http.StatusForbidden)
+}
+
+func TestErrorHandlerRouteAndStack(t *testing.T) {
+	var routePath, stack string
+	router := New(Context{})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		routePath = r.RoutePath()
+		stack = r.PanicStack()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	router.Get("/users/:id", (*Context).ErrorAction)
+	router.Get("/returned", func(w ResponseWriter, r *Request) error {
+		return errors.New("returned")
+	})
+
+	rw, req := newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "/users/:id", routePath)
+	assert.Contains(t, stack, "ErrorAction")
+
+	rw, req = newTestRequest("GET", "/returned")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "/returned", routePath)
+	assert.Empty(t, stack)
+}
+
+func TestPanickingErrorHandler(t *testing.T) {
+	var panics []interface{}
+	oldHandler := PanicHandler
+	PanicHandler = recordingPanicReporter{panics: &panics}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		panic("error handler")
+	})
+	router.Get("/action", (*Context).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+	if assert.Len(t, panics, 2) {
+		assert.Equal(t, "error handler", panics[0])
+		assert.Contains(t, fmt.Sprint(panics[1]), "divide by zero")
+	}
+}
+
+func TestPanickingNotFoundHandler(t *testing.T) {
+	var panics []interface{}
+	oldHandler := PanicHandler
+	PanicHandler = recordingPanicReporter{panics: &panics}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.NotFound(func(w ResponseWriter, r *Request) {
+		panic("not found handler")
+	})
+
+	rw, req := newTestRequest("GET", "/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+	assert.Equal(t, []interface{}{"not found handler"}, panics)
+}
+
+type panickingPanicReporter struct{}
+
+func (panickingPanicReporter) Panic(url string, err interface{}, stack string) {
+	panic("reporter")
+}
+
+func TestPanickingPanicHandler(t *testing.T) {
+	var buf bytes.Buffer
+	oldHandler, oldDefault := PanicHandler, defaultPanicReporter
+	PanicHandler = panickingPanicReporter{}
+	defaultPanicReporter = logPanicReporter{log: log.New(&buf, "", 0)}
+	defer func() {
+		PanicHandler, defaultPanicReporter = oldHandler, oldDefault
+	}()
+
+	router := New(Context{})
+	router.Get("/action", (*Context).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/action")
+	assert.NotPanics(t, func() {
+		router.ServeHTTP(rw, req)
+	})
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+	assert.Contains(t, buf.String(), "divide by zero")
+	assert.Contains(t, buf.String(), "PanicHandler panicked: reporter")
+}
+
+func TestAbortHandlerPanic(t *testing.T) {
+	var panics []interface{}
+	oldHandler := PanicHandler
+	PanicHandler = recordingPanicReporter{panics: &panics}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	var errorHandled bool
+	router := New(Context{})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		if err == "abort" {
+			panic(http.ErrAbortHandler)
+		}
+		errorHandled = true
+	})
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		panic(http.ErrAbortHandler)
+	})
+	router.Get("/nested", func(w ResponseWriter, r *Request) {
+		panic("abort")
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		router.ServeHTTP(rw, req)
+	})
+	assert.False(t, errorHandled)
+	assert.Empty(t, panics)
+
+	rw, req = newTestRequest("GET", "/nested")
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		router.ServeHTTP(rw, req)
+	})
+	assert.Equal(t, []interface{}{"abort"}, panics)
+}
+
+func TestPanicAfterHeadersSent(t *testing.T) {
+	router := New(Context{})
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "partial")
+		panic("too late")
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "partial", http.StatusOK)
+}
@@ -0,0 +1,153 @@
+package grom
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// HTTPError is an error that knows which response it should produce.
+// Handlers and middleware can return it or panic with it. Unless an Error handler takes over,
+// grom then writes Status, Header and Message instead of a 500 with DefaultPanicResponse.
+// Panics with an HTTPError whose Status is below 500 are expected and aren't reported to PanicHandler.
+type HTTPError struct {
+	// Status is the HTTP status code of the response.
+	Status int
+	// Message is written to the client. If it's empty, the status text is written instead.
+	Message string
+	// Cause is the underlying error. It's only meant for logs and is never written to the client.
+	Cause error
+	// Header is added to the response headers.
+	Header http.Header
+}
+
+// NewHTTPError returns an HTTPError with the given status and public message.
+func NewHTTPError(status int, message string) *HTTPError {
+	return &HTTPError{Status: status, Message: message}
+}
+
+// BadRequest returns an HTTPError with status 400 and the given public message.
+func BadRequest(message string) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, message)
+}
+
+// Unauthorized returns an HTTPError with status 401 and the given public message.
+func Unauthorized(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, message)
+}
+
+// Forbidden returns an HTTPError with status 403 and the given public message.
+func Forbidden(message string) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, message)
+}
+
+// NotFound returns an HTTPError with status 404 and the given public message.
+func NotFound(message string) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, message)
+}
+
+// MethodNotAllowed returns an HTTPError with status 405 and the given public message.
+// allowed are the methods listed in the Allow header.
+func MethodNotAllowed(message string, allowed ...string) *HTTPError {
+	return NewHTTPError(http.StatusMethodNotAllowed, message).WithHeader("Allow", strings.Join(allowed, ", "))
+}
+
+// Conflict returns an HTTPError with status 409 and the given public message.
+func Conflict(message string) *HTTPError {
+	return NewHTTPError(http.StatusConflict, message)
+}
+
+// UnprocessableEntity returns an HTTPError with status 422 and the given public message.
+func UnprocessableEntity(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnprocessableEntity, message)
+}
+
+// InternalServerError returns an HTTPError with status 500 and the given public message.
+func InternalServerError(message string) *HTTPError {
+	return NewHTTPError(http.StatusInternalServerError, message)
+}
+
+// Error returns the public message, followed by the cause if there is one.
+func (e *HTTPError) Error() string {
+	msg := e.publicMessage()
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the error.
+func (e *HTTPError) Unwrap() error {
+	return e.Cause
+}
+
+// WithCause sets the internal cause of the error and returns the error.
+func (e *HTTPError) WithCause(cause error) *HTTPError {
+	e.Cause = cause
+	return e
+}
+
+// WithHeader adds a response header to the error and returns the error.
+func (e *HTTPError) WithHeader(key, value string) *HTTPError {
+	if e.Header == nil {
+		e.Header = http.Header{}
+	}
+	e.Header.Add(key, value)
+	return e
+}
+
+func (e *HTTPError) publicMessage() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return http.StatusText(e.Status)
+}
+
+// httpErrorOf returns the HTTPError in err's chain, if err is an error and has one.
+func httpErrorOf(err interface{}) (*HTTPError, bool) {
+	e, ok := err.(error)
+	if !ok {
+		return nil, false
+	}
+	var httpErr *HTTPError
+	if errors.As(e, &httpErr) {
+		return httpErr, true
+	}
+	return nil, false
+}
+
+// expectedError returns true if err is an HTTPError or a Problem with a client error status.
+func expectedError(err interface{}) bool {
+	p, known := problemFor(err)
+	return known && p.Status < http.StatusInternalServerError
+}
+
+// writeError writes the default response for err, which is a panic or an error returned by a handler.
+// If problems is true, the response is a problem details document (see Router.ProblemDetails).
+// Nothing is written if the headers have already been sent, since the status can't be changed anymore
+// and a body would be appended to whatever the handler wrote.
+func writeError(rw ResponseWriter, req *Request, err interface{}, problems bool) {
+	if rw.Written() {
+		return
+	}
+
+	if httpErr, ok := httpErrorOf(err); ok {
+		for key, values := range httpErr.Header {
+			for _, value := range values {
+				rw.Header().Add(key, value)
+			}
+		}
+	}
+
+	p, known := problemFor(err)
+	switch {
+	case problems:
+		writeProblem(rw, req, p)
+	case known && p.Detail != "":
+		http.Error(rw, p.Detail, p.Status)
+	case known:
+		http.Error(rw, p.title(), p.Status)
+	default:
+		http.Error(rw, DefaultPanicResponse, http.StatusInternalServerError)
+	}
+}
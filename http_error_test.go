@@ -0,0 +1,89 @@
+package grom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPErrorReturned(t *testing.T) {
+	router := New(Context{})
+	router.Get("/user", func(w ResponseWriter, r *Request) error {
+		return NotFound("no such user").WithCause(errors.New("sql: no rows"))
+	})
+	router.Get("/login", func(w ResponseWriter, r *Request) error {
+		return Unauthorized("").WithHeader("WWW-Authenticate", "Basic")
+	})
+	router.Get("/wrapped", func(w ResponseWriter, r *Request) error {
+		return fmt.Errorf("loading: %w", BadRequest("bad id"))
+	})
+
+	rw, req := newTestRequest("GET", "/user")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "no such user", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/login")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Unauthorized", http.StatusUnauthorized)
+	assert.Equal(t, "Basic", rw.Header().Get("WWW-Authenticate"))
+
+	rw, req = newTestRequest("GET", "/wrapped")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "bad id", http.StatusBadRequest)
+}
+
+func TestHTTPErrorPanic(t *testing.T) {
+	var panics []interface{}
+	oldHandler := PanicHandler
+	PanicHandler = recordingPanicReporter{panics: &panics}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.Get("/forbidden", func(w ResponseWriter, r *Request) {
+		panic(Forbidden("admins only"))
+	})
+	router.Get("/broken", func(w ResponseWriter, r *Request) {
+		panic(InternalServerError("try again later"))
+	})
+
+	rw, req := newTestRequest("GET", "/forbidden")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "admins only", http.StatusForbidden)
+	assert.Empty(t, panics)
+
+	rw, req = newTestRequest("GET", "/broken")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "try again later", http.StatusInternalServerError)
+	assert.Len(t, panics, 1)
+}
+
+func TestHTTPErrorWithErrorHandler(t *testing.T) {
+	router := New(Context{})
+	router.Error(func(w ResponseWriter, r *Request, err interface{}) {
+		var httpErr *HTTPError
+		if errors.As(err.(error), &httpErr) {
+			w.WriteHeader(httpErr.Status)
+			fmt.Fprintf(w, "custom %s", httpErr.Message)
+		}
+	})
+	router.Get("/action", func(w ResponseWriter, r *Request) error {
+		return Conflict("taken")
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "custom taken", http.StatusConflict)
+}
+
+func TestHTTPErrorMessage(t *testing.T) {
+	cause := errors.New("sql: no rows")
+	err := NotFound("no such user").WithCause(cause)
+	assert.Equal(t, "no such user: sql: no rows", err.Error())
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, "Unprocessable Entity", UnprocessableEntity("").Error())
+}
@@ -14,6 +14,14 @@ func (c *Context) InvalidHandler2(w ResponseWriter, r *Request) string {
 
 func (c *Context) InvalidHandler3(w ResponseWriter, r ResponseWriter) {}
 
+func (c *Context) InvalidHandler4(w ResponseWriter, r *Request) (int, error) {
+	return 0, nil
+}
+
+func (c *Context) StringReturningErrorHandler(w ResponseWriter, r *Request, err interface{}) string {
+	return ""
+}
+
 type invalidSubcontext struct{}
 
 func (c *invalidSubcontext) Handler(w ResponseWriter, r *Request) {}
@@ -50,6 +58,11 @@ func TestInvalidError(t *testing.T) {
 	assert.Panics(t, func() {
 		router.Error((*Context).InvalidHandler)
 	})
+
+	// Error handlers can only return an error:
+	assert.Panics(t, func() {
+		router.Error((*Context).StringReturningErrorHandler)
+	})
 }
 
 func TestInvalidNotFound(t *testing.T) {
@@ -58,8 +71,8 @@ func TestInvalidNotFound(t *testing.T) {
 		router.NotFound((*Context).InvalidHandler)
 	})
 
-	// Valid handler not on main router:
-	subrouter := router.Subrouter(Context{}, "")
+	// Handler for the wrong context type on a subrouter:
+	subrouter := router.Subrouter(AdminContext{}, "/admin")
 	assert.Panics(t, func() {
 		subrouter.NotFound((*Context).A)
 	})
@@ -80,6 +93,11 @@ func TestInvalidHandler(t *testing.T) {
 		router.Get("/action", (*Context).InvalidHandler2)
 	})
 
+	// Returns an int and an error:
+	assert.Panics(t, func() {
+		router.Get("/action", (*Context).InvalidHandler4)
+	})
+
 	// Two writer inputs:
 	assert.Panics(t, func() {
 		router.Get("/action", (*Context).InvalidHandler3)
@@ -3,6 +3,8 @@ package grom
 import (
 	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func (c *Context) A(w ResponseWriter, r *Request) {
@@ -268,3 +270,127 @@ func TestInterfaceMiddleware(t *testing.T) {
 	router.ServeHTTP(rw, req)
 	assertResponse(t, rw, "context-mw-Interface context-A", 200)
 }
+
+func TestRoutedMiddleware(t *testing.T) {
+	var rootContexts []*Context
+	router := New(Context{})
+	router.RoutedMiddleware(func(c *Context, w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		rootContexts = append(rootContexts, c)
+		fmt.Fprintf(w, "routed(%s %s) ", r.RoutePath(), r.PathParams["id"])
+		next(w, r)
+	})
+	router.Middleware(func(c *Context, w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		rootContexts = append(rootContexts, c)
+		fmt.Fprintf(w, "root(%v) ", r.IsRouted())
+		next(w, r)
+	})
+	router.Get("/action", (*Context).A)
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Middleware((*AdminContext).mwEpsilon)
+	admin.Get("/users/:id", (*AdminContext).B)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root(false) routed(/action ) context-A", 200)
+
+	rw, req = newTestRequest("GET", "/admin/users/4")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root(false) routed(/admin/users/:id 4) admin-mw-Epsilon admin-B", 200)
+
+	for i := 0; i < len(rootContexts); i += 2 {
+		if rootContexts[i] != rootContexts[i+1] {
+			t.Error("Expected routed middleware to share the root context")
+		}
+	}
+
+	// Routed middleware doesn't run if no route matches.
+	// (The status is 200 since the root middleware has written the body already.)
+	rw, req = newTestRequest("GET", "/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root(false) Not Found", 200)
+}
+
+func TestRoutedMiddlewareStopsChain(t *testing.T) {
+	router := New(Context{})
+	router.RoutedMiddleware((*Context).mwAlpha)
+	router.RoutedMiddleware((*Context).mwNoNext)
+	router.Get("/action", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-mw-Alpha context-mw-NoNext", 200)
+
+	assert.Panics(t, func() {
+		router.Subrouter(Context{}, "/sub").RoutedMiddleware((*Context).mwAlpha)
+	})
+}
+
+func TestMiddlewareExcept(t *testing.T) {
+	router := New(Context{})
+	router.MiddlewareExcept((*Context).mwAlpha, "/login", "/health")
+	router.Get("/login", (*Context).A)
+	router.Get("/health", (*Context).A)
+	router.Get("/action", (*Context).A)
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.MiddlewareExcept((*AdminContext).mwEpsilon, "/users/:id")
+	admin.Get("/users/:id", (*AdminContext).B)
+	admin.Get("/users", (*AdminContext).B)
+
+	rw, req := newTestRequest("GET", "/login")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-A", 200)
+
+	rw, req = newTestRequest("GET", "/health")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-A", 200)
+
+	// The router ignores a trailing slash, and so does the exception.
+	rw, req = newTestRequest("GET", "/login/")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-A", 200)
+
+	rw, req = newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-mw-Alpha context-A", 200)
+
+	// Route paths are matched once the request has been routed.
+	rw, req = newTestRequest("GET", "/admin/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-mw-Alpha admin-B", 200)
+
+	rw, req = newTestRequest("GET", "/admin/users")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-mw-Alpha admin-mw-Epsilon admin-B", 200)
+}
+
+func TestWhenMiddleware(t *testing.T) {
+	isAdminRoute := func(req *Request) bool {
+		return req.PathParams["id"] == "admin"
+	}
+	router := New(Context{})
+	router.RoutedMiddleware(When(isAdminRoute, (*Context).mwAlpha))
+	router.Middleware(When(func(req *Request) bool {
+		return req.URL.Query().Get("beta") != ""
+	}, func(w ResponseWriter, r *Request, next NextMiddlewareFunc) error {
+		fmt.Fprintf(w, "generic-beta ")
+		next(w, r)
+		return nil
+	}))
+	router.Get("/users/:id", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/users/admin")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-mw-Alpha context-A", 200)
+
+	rw, req = newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-A", 200)
+
+	rw, req = newTestRequest("GET", "/users/3?beta=1")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic-beta context-A", 200)
+
+	assert.Panics(t, func() {
+		router.Middleware(When(isAdminRoute, (*AdminContext).mwEpsilon))
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func (c *Context) HandlerWithContext(rw ResponseWriter, r *Request) {
@@ -47,3 +49,156 @@ func TestWithHandler(t *testing.T) {
 	router.ServeHTTP(rw, req)
 	assertResponse(t, rw, "My Not Found", http.StatusNotFound)
 }
+
+type NotFoundContext struct {
+	*Context
+	Name string
+}
+
+func TestSubrouterNotFound(t *testing.T) {
+	router := New(Context{})
+	router.NotFound(MyNotFoundHandler)
+	router.Get("/", (*Context).A)
+
+	api := router.Subrouter(NotFoundContext{}, "/api")
+	api.Middleware(func(c *NotFoundContext, rw ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		c.Name = "api"
+		rw.Header().Set("Content-Type", "application/json")
+		next(rw, r)
+	})
+	api.NotFound(func(c *NotFoundContext, rw ResponseWriter, r *Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(rw, `{"error":"not found","from":%q}`, c.Name)
+	})
+	api.Get("/users", func(rw ResponseWriter, r *Request) {})
+
+	v2 := api.Subrouter(NotFoundContext{}, "/v2")
+	v2.Get("/users", func(rw ResponseWriter, r *Request) {})
+
+	rw, req := newTestRequest("GET", "/api/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, `{"error":"not found","from":"api"}`, http.StatusNotFound)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+	// Subrouters without a NotFound handler use their parent's.
+	rw, req = newTestRequest("GET", "/api/v2/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, `{"error":"not found","from":"api"}`, http.StatusNotFound)
+
+	// Wrong method for an existing path.
+	rw, req = newTestRequest("POST", "/api/users")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, `{"error":"not found","from":"api"}`, http.StatusNotFound)
+
+	// Prefixes only match whole path segments.
+	rw, req = newTestRequest("GET", "/apiary")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "My Not Found", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "My Not Found", http.StatusNotFound)
+}
+
+func TestDeepestSubrouterNotFound(t *testing.T) {
+	router := New(Context{})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.NotFound(func(rw ResponseWriter, r *Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(rw, "Admin Not Found")
+	})
+	reports := admin.Subrouter(AdminContext{}, "/reports")
+	reports.NotFound(func(rw ResponseWriter, r *Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(rw, "Reports Not Found")
+	})
+
+	rw, req := newTestRequest("GET", "/admin/reports/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Reports Not Found", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/admin/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Admin Not Found", http.StatusNotFound)
+
+	// No NotFound handler applies.
+	rw, req = newTestRequest("GET", "/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Not Found", http.StatusNotFound)
+}
+
+func TestNotFoundPrefixWithTrailingSlash(t *testing.T) {
+	router := New(Context{})
+	api := router.Subrouter(Context{}, "/api")
+	api.NotFound(func(rw ResponseWriter, r *Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(rw, "api404")
+	})
+	admin := api.Subrouter(Context{}, "/admin/")
+	admin.NotFound(func(rw ResponseWriter, r *Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(rw, "admin404")
+	})
+	v2 := router.Subrouter(Context{}, "/v2")
+	v2.Subrouter(Context{}, "").ProblemDetails(true)
+
+	rw, req := newTestRequest("GET", "/api/admin/x")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "admin404", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/api/admin")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "admin404", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/api/x")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "api404", http.StatusNotFound)
+
+	rw, req = newTestRequest("GET", "/v2/x")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+}
+
+func TestTypedSubrouterNotFound(t *testing.T) {
+	router := NewTyped[Context]()
+	api := Subrouter[Context, APIContext](router, "/api")
+	api.NotFound(func(c *APIContext, rw ResponseWriter, r *Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(rw, "Typed Not Found %v", c.Context != nil)
+	})
+
+	rw, req := newTestRequest("GET", "/api/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Typed Not Found true", http.StatusNotFound)
+}
+
+func TestNotFoundIsNotRouted(t *testing.T) {
+	router := New(Context{})
+	router.RoutedMiddleware(func(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		fmt.Fprintf(w, "routed(%v %q) ", r.IsRouted(), r.RoutePath())
+		next(w, r)
+	})
+	router.Get("/", (*Context).A)
+	api := router.Subrouter(NotFoundContext{}, "/api")
+	api.Middleware(When(func(r *Request) bool {
+		return r.IsRouted()
+	}, func(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		fmt.Fprintf(w, "when(%q) ", r.RoutePath())
+		next(w, r)
+	}))
+	api.NotFound(func(rw ResponseWriter, r *Request) {
+		fmt.Fprintf(rw, "not found(%v)", r.IsRouted())
+	})
+	api.Get("/users", func(rw ResponseWriter, r *Request) {
+		fmt.Fprintf(rw, "users(%v)", r.IsRouted())
+	})
+
+	rw, req := newTestRequest("GET", "/api/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, `routed(false "") not found(false)`, http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/api/users")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, `routed(true "/api/users") when("/api/users") users(true)`, http.StatusOK)
+}
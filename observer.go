@@ -0,0 +1,109 @@
+package grom
+
+import "time"
+
+// Observer receives the events in the lifecycle of each request served by a root router (see Router.Observe).
+// Instrumentation such as metrics, tracing or auditing can implement it instead of being middleware
+// that has to be added at the right position. Embed BaseObserver to implement only some of the events.
+// The events of a request are sent from the goroutine that serves it.
+type Observer interface {
+	// OnRequestStart is called when the router starts serving req, before any middleware.
+	OnRequestStart(req *Request)
+	// OnRouteMatched is called once a route has been found for req, before the routed middleware.
+	OnRouteMatched(req *Request, route RouteInfo)
+	// OnNotFound is called when no route matches the path of req, before any NotFound handler.
+	OnNotFound(req *Request)
+	// OnMethodNotAllowed is called instead of OnNotFound when routes match the path of req,
+	// but not its method. allowed are the methods of the routes that match.
+	OnMethodNotAllowed(req *Request, allowed []string)
+	// OnPanic is called with the report of a panic in the middleware or handlers of req,
+	// when it's reported to the PanicHandler. That includes server errors they returned
+	// that no Error handler handled, which are reported without a stack.
+	OnPanic(req *Request, report *PanicReport)
+	// OnResponseComplete is called once req has been served, with the status code and
+	// the size of the body that were written, and the time it took.
+	OnResponseComplete(req *Request, status int, size int, duration time.Duration)
+}
+
+// RouteInfo describes the route that a request matched.
+type RouteInfo struct {
+	Method string
+	Path   string // The pattern of the route, e.g. "/users/:id".
+}
+
+// BaseObserver implements Observer with methods that do nothing.
+type BaseObserver struct{}
+
+func (BaseObserver) OnRequestStart(req *Request)                                                   {}
+func (BaseObserver) OnRouteMatched(req *Request, route RouteInfo)                                  {}
+func (BaseObserver) OnNotFound(req *Request)                                                       {}
+func (BaseObserver) OnMethodNotAllowed(req *Request, allowed []string)                             {}
+func (BaseObserver) OnPanic(req *Request, report *PanicReport)                                     {}
+func (BaseObserver) OnResponseComplete(req *Request, status int, size int, duration time.Duration) {}
+
+// Observe adds an observer of the requests served by the router and returns the router.
+// Observers are notified in the order they were added. They can only be added to the root router.
+func (r *Router) Observe(observer Observer) *Router {
+	if r.parent != nil {
+		panic("You can only add an Observer to the root router.")
+	}
+	r.observers = append(r.observers, observer)
+	return r
+}
+
+func (r *Router) observeRequestStart(req *Request) {
+	for _, observer := range r.observers {
+		observer.OnRequestStart(req)
+	}
+}
+
+func (r *Router) observeRouteMatched(req *Request, route *route) {
+	for _, observer := range r.observers {
+		observer.OnRouteMatched(req, RouteInfo{Method: string(route.Method), Path: route.Path})
+	}
+}
+
+// observeNotFound notifies OnMethodNotAllowed if routes for other methods match the path, and OnNotFound otherwise.
+func (r *Router) observeNotFound(req *Request) {
+	if len(r.observers) == 0 {
+		return
+	}
+	allowed := r.allowedMethods(req.URL.Path)
+	for _, observer := range r.observers {
+		if len(allowed) > 0 {
+			observer.OnMethodNotAllowed(req, allowed)
+		} else {
+			observer.OnNotFound(req)
+		}
+	}
+}
+
+// observePanic and observeResponseComplete are called once the middleware stack has unwound,
+// so a panic in an observer is reported to the PanicHandler and doesn't keep the other observers from being notified.
+func (r *Router) observePanic(req *Request, report *PanicReport) {
+	for _, observer := range r.observers {
+		func() {
+			defer r.recoverObserver(req)
+			observer.OnPanic(req, report)
+		}()
+	}
+}
+
+func (r *Router) observeResponseComplete(req *Request, rw *appResponseWriter, start time.Time) {
+	if len(r.observers) == 0 {
+		return
+	}
+	duration := time.Since(start)
+	for _, observer := range r.observers {
+		func() {
+			defer r.recoverObserver(req)
+			observer.OnResponseComplete(req, rw.finalStatusCode(), rw.size, duration)
+		}()
+	}
+}
+
+func (r *Router) recoverObserver(req *Request) {
+	if recovered := recover(); recovered != nil {
+		reportPanic(r, newPanicReport(req, recovered))
+	}
+}
@@ -0,0 +1,155 @@
+package grom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingObserver struct {
+	events *[]string
+}
+
+func (o recordingObserver) OnRequestStart(req *Request) {
+	*o.events = append(*o.events, "start "+req.URL.Path)
+}
+
+func (o recordingObserver) OnRouteMatched(req *Request, route RouteInfo) {
+	*o.events = append(*o.events, fmt.Sprintf("matched %s %s %v", route.Method, route.Path, req.PathParams))
+}
+
+func (o recordingObserver) OnNotFound(req *Request) {
+	*o.events = append(*o.events, "not found")
+}
+
+func (o recordingObserver) OnMethodNotAllowed(req *Request, allowed []string) {
+	*o.events = append(*o.events, "method not allowed "+strings.Join(allowed, ","))
+}
+
+func (o recordingObserver) OnPanic(req *Request, report *PanicReport) {
+	*o.events = append(*o.events, fmt.Sprintf("panic %v", report.Value))
+}
+
+func (o recordingObserver) OnResponseComplete(req *Request, status int, size int, duration time.Duration) {
+	*o.events = append(*o.events, fmt.Sprintf("complete %d %d", status, size))
+}
+
+func TestObserver(t *testing.T) {
+	var events []string
+	var panics []interface{}
+	router := New(Context{}).Observe(recordingObserver{events: &events})
+	router.PanicHandler(recordingPanicReporter{panics: &panics})
+	router.Middleware(func(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		events = append(events, "middleware")
+		next(w, r)
+	})
+	router.Get("/users/:id", (*Context).A)
+	router.Get("/error", (*Context).ErrorAction)
+	router.Get("/empty", func(w ResponseWriter, r *Request) {})
+	router.Get("/returned", func(w ResponseWriter, r *Request) error {
+		return errors.New("boom")
+	})
+
+	tests := []struct {
+		method, path string
+		events       []string
+	}{
+		{"GET", "/users/3", []string{"start /users/3", "middleware", "matched GET /users/:id map[id:3]", "complete 200 9"}},
+		{"POST", "/users/3", []string{"start /users/3", "middleware", "method not allowed GET", "complete 404 9"}},
+		{"GET", "/missing", []string{"start /missing", "middleware", "not found", "complete 404 9"}},
+		{"GET", "/error", []string{"start /error", "middleware", "matched GET /error map[]", "panic runtime error: integer divide by zero", "complete 500 18"}},
+		{"GET", "/empty", []string{"start /empty", "middleware", "matched GET /empty map[]", "complete 200 0"}},
+		{"GET", "/returned", []string{"start /returned", "middleware", "matched GET /returned map[]", "panic boom", "complete 500 18"}},
+	}
+	for _, test := range tests {
+		events = nil
+		rw, req := newTestRequest(test.method, test.path)
+		router.ServeHTTP(rw, req)
+		assert.Equal(t, test.events, events, "%s %s", test.method, test.path)
+	}
+	assert.Len(t, panics, 2)
+}
+
+type notFoundObserver struct {
+	BaseObserver
+	notFound *int
+}
+
+func (o notFoundObserver) OnNotFound(req *Request) {
+	*o.notFound++
+}
+
+func TestObserverWithNotFoundHandler(t *testing.T) {
+	var notFound int
+	router := New(Context{}).Observe(notFoundObserver{notFound: &notFound})
+	router.NotFound(func(w ResponseWriter, r *Request) {
+		fmt.Fprint(w, "custom")
+	})
+
+	rw, req := newTestRequest("GET", "/missing")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "custom", 200)
+	assert.Equal(t, 1, notFound)
+
+	assert.Panics(t, func() {
+		router.Subrouter(Context{}, "/sub").Observe(BaseObserver{})
+	})
+}
+
+type panickingObserver struct {
+	BaseObserver
+}
+
+func (panickingObserver) OnPanic(req *Request, report *PanicReport) {
+	panic("OnPanic")
+}
+
+func (panickingObserver) OnResponseComplete(req *Request, status int, size int, duration time.Duration) {
+	panic("OnResponseComplete")
+}
+
+func TestPanickingObserver(t *testing.T) {
+	var events []string
+	var retained ResponseWriter
+	router, misuses := strictRouter()
+	var reports []*PanicReport
+	router.PanicHandler(recordingStructuredReporter{reports: &reports})
+	router.Observe(panickingObserver{}).Observe(recordingObserver{events: &events})
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		retained = w
+		fmt.Fprint(w, "ok")
+	})
+	router.Get("/error", (*Context).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/action")
+	assert.NotPanics(t, func() {
+		router.ServeHTTP(rw, req)
+	})
+	assertResponse(t, rw, "ok", 200)
+	assert.Equal(t, []string{"start /action", "matched GET /action map[]", "complete 200 2"}, events)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "OnResponseComplete", reports[0].Value)
+		assert.Equal(t, "github.com/pchchv/grom.panickingObserver.OnResponseComplete", reports[0].Frames[0].Function)
+	}
+
+	// The request was still marked as served.
+	fmt.Fprint(retained, "late")
+	if assert.Len(t, *misuses, 1) {
+		assert.Equal(t, ResponseWriterRetained, (*misuses)[0].Kind)
+	}
+
+	events, reports = nil, nil
+	rw, req = newTestRequest("GET", "/error")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", 500)
+	assert.Contains(t, events, "panic runtime error: integer divide by zero")
+	if assert.Len(t, reports, 3) {
+		assert.EqualError(t, reports[0].Value.(error), "runtime error: integer divide by zero")
+		assert.Equal(t, "OnPanic", reports[1].Value)
+		assert.Equal(t, "OnResponseComplete", reports[2].Value)
+	}
+}
@@ -6,13 +6,68 @@ import (
 	"strings"
 )
 
-func (r *Router) genericOptionsHandler(ctx reflect.Value, methods []string) func(rw ResponseWriter, req *Request) {
-	return func(rw ResponseWriter, req *Request) {
-		if r.optionsHandler.IsValid() {
-			invoke(r.optionsHandler, ctx, []reflect.Value{reflect.ValueOf(rw), reflect.ValueOf(req), reflect.ValueOf(methods)})
-		} else {
-			rw.Header().Add("Access-Control-Allow-Methods", strings.Join(methods, ", "))
-			rw.WriteHeader(http.StatusOK)
+// optionsRoute returns a route that answers an OPTIONS request for which no OPTIONS route was added,
+// and the path params for it. The route is nil if no route matches the path with any method.
+// It belongs to the router of a route that matches the path, preferably the route for the method that
+// a CORS preflight request asks about, so that router's middleware runs and its contexts are built.
+func (rootRouter *Router) optionsRoute(req *Request) (*route, map[string]string) {
+	preflightMethod := req.Header.Get("Access-Control-Request-Method")
+	methods := make([]string, 0, len(httpMethods))
+	var matched *route
+	var wildcardMap map[string]string
+	for _, method := range httpMethods {
+		if method == httpMethodOptions {
+			continue
+		}
+		leaf, wildcards := rootRouter.root[method].Match(req.URL.Path)
+		if leaf == nil {
+			continue
 		}
+		methods = append(methods, string(method))
+		// Keep the last matching route, unless the preflight method's route was found.
+		if matched == nil || string(matched.Method) != preflightMethod {
+			matched, wildcardMap = leaf.route, wildcards
+		}
+	}
+
+	if matched == nil {
+		return nil, nil
+	}
+	handler := matched.Router.optionsActionHandler(methods)
+	return &route{Method: httpMethodOptions, Path: matched.Path, Router: matched.Router, Handler: handler}, wildcardMap
+}
+
+// optionsActionHandler returns the handler that answers an OPTIONS request for a route of r,
+// given the methods that have a route for the path.
+// It invokes the OptionsHandler of r or of its nearest parent that has one, with that router's context.
+func (r *Router) optionsActionHandler(methods []string) *actionHandler {
+	target, level := r, r.level()
+	for target != nil && !target.optionsHandler.IsValid() {
+		target, level = target.parent, level-1
+	}
+
+	if target == nil {
+		return &actionHandler{Generic: true, GenericHandler: func(rw ResponseWriter, req *Request) {
+			// Middleware such as CORSMiddleware may have restricted the methods already.
+			if rw.Header().Get("Access-Control-Allow-Methods") == "" {
+				rw.Header().Add("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			}
+			rw.WriteHeader(http.StatusOK)
+		}}
+	}
+
+	return &actionHandler{Name: funcName(target.optionsHandler), ContextHandler: func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+		// Contexts line up with the routers from the root router to the route's router.
+		invoke(target.optionsHandler, req.contexts[level], []reflect.Value{reflect.ValueOf(rw), reflect.ValueOf(req), reflect.ValueOf(methods)})
+		return nil
+	}}
+}
+
+// level returns the number of parents of r.
+func (r *Router) level() int {
+	level := 0
+	for cur := r.parent; cur != nil; cur = cur.parent {
+		level++
 	}
+	return level
 }
@@ -51,3 +51,94 @@ func TestCustomOptionsHandler(t *testing.T) {
 	assert.Equal(t, "GET, PUT", rw.Header().Get("Access-Control-Allow-Methods"))
 	assert.Equal(t, "100", rw.Header().Get("Access-Control-Max-Age"))
 }
+
+type OptionsContext struct {
+	*Context
+	Origin string
+}
+
+func TestSubrouterOptionsHandler(t *testing.T) {
+	router := New(Context{})
+	router.OptionsHandler((*Context).OptionsHandler)
+	router.Get("/action", (*Context).A)
+
+	api := router.Subrouter(OptionsContext{}, "/api")
+	api.Middleware(func(c *OptionsContext, rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		c.Origin = "api-origin"
+		next(rw, req)
+	})
+	api.OptionsHandler(func(c *OptionsContext, rw ResponseWriter, req *Request, methods []string) {
+		rw.Header().Set("Access-Control-Allow-Origin", c.Origin)
+		rw.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		rw.Header().Set("X-User", req.PathParams["id"])
+	})
+	api.Get("/users/:id", (*OptionsContext).A)
+	api.Delete("/users/:id", (*OptionsContext).A)
+
+	users := api.Subrouter(OptionsContext{}, "/admin")
+	users.Put("/settings/:key", (*OptionsContext).A)
+
+	rw, req := newTestRequest("OPTIONS", "/api/users/7")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "api-origin", rw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, DELETE", rw.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "7", rw.Header().Get("X-User"))
+	assert.Equal(t, "", rw.Header().Get("Access-Control-Max-Age"))
+
+	// Subrouters without an OptionsHandler use their parent's, with the parent's context.
+	rw, req = newTestRequest("OPTIONS", "/api/admin/settings/theme")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "api-origin", rw.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "PUT", rw.Header().Get("Access-Control-Allow-Methods"))
+
+	rw, req = newTestRequest("OPTIONS", "/action")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "GET", rw.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "100", rw.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestOptionsPreflightRoute(t *testing.T) {
+	router := New(Context{})
+	router.OptionsHandler(func(rw ResponseWriter, req *Request, methods []string) {
+		rw.Header().Set("X-Route", req.RoutePath())
+	})
+	router.Get("/users/:id", (*Context).A)
+	router.Post("/users/:name", (*Context).A)
+
+	rw, req := newTestRequest("OPTIONS", "/users/7")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "/users/:id", rw.Header().Get("X-Route"))
+
+	rw, req = newTestRequest("OPTIONS", "/users/7")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "/users/:name", rw.Header().Get("X-Route"))
+}
+
+func TestOptionsRouteOverride(t *testing.T) {
+	router := New(Context{})
+	router.Get("/upload", (*Context).A)
+	router.Post("/upload", (*Context).A)
+	router.Options("/upload", func(rw ResponseWriter, req *Request) {
+		rw.Header().Set("Access-Control-Allow-Methods", strings.Join(req.AllowedMethods(), ", "))
+		rw.Header().Set("Access-Control-Max-Age", "600")
+	})
+
+	rw, req := newTestRequest("OPTIONS", "/upload")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "GET, POST", rw.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "600", rw.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestTypedSubrouterOptionsHandler(t *testing.T) {
+	router := NewTyped[Context]()
+	api := Subrouter[Context, OptionsContext](router, "/api")
+	api.OptionsHandler(func(c *OptionsContext, rw ResponseWriter, req *Request, methods []string) {
+		rw.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ","))
+	})
+	api.Get("/a", func(c *OptionsContext, rw ResponseWriter, req *Request) {})
+
+	rw, req := newTestRequest("OPTIONS", "/api/a")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "GET", rw.Header().Get("Access-Control-Allow-Methods"))
+}
@@ -1,6 +1,7 @@
 package grom
 
 import (
+	"fmt"
 	"log"
 	"os"
 )
@@ -9,15 +10,19 @@ import (
 // Applications can set web.PanicHandler = your own logger, if they wish.
 // In terms of logging the requests / responses, see logger_middleware.
 // That is a completely separate system.
-var PanicHandler = PanicReporter(logPanicReporter{
+var PanicHandler = PanicReporter(defaultPanicReporter)
+
+// defaultPanicReporter is also used to report panics that happen in PanicHandler itself.
+var defaultPanicReporter = logPanicReporter{
 	log: log.New(os.Stderr, "ERROR ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile),
-})
+}
 
 // PanicReporter can receive panics that happen when serving
 // a request and report them to a log of some sort.
 type PanicReporter interface {
 	// Panic is called with the URL of the request,
-	// the result of calling recover, and the stack.
+	// the result of calling recover, and the full stack.
+	// Implement StructuredPanicReporter as well to get more details.
 	Panic(url string, err interface{}, stack string)
 }
 
@@ -28,3 +33,62 @@ type logPanicReporter struct {
 func (l logPanicReporter) Panic(url string, err interface{}, stack string) {
 	l.log.Printf("PANIC\nURL: %v\nERROR: %v\nSTACK:\n%s\n", url, err, stack)
 }
+
+// PanicHandler sets the reporter that panics in this router and its subrouters are reported to, and returns the router.
+// Routers without one report to their parent's reporter, and the root router reports to the global PanicHandler.
+// Use MultiPanicReporter to report to several sinks.
+func (r *Router) PanicHandler(reporter PanicReporter) *Router {
+	r.panicReporter = reporter
+	return r
+}
+
+// panicReporterFor returns the reporter that panics in the router are reported to.
+func (r *Router) panicReporterFor() PanicReporter {
+	for cur := r; cur != nil; cur = cur.parent {
+		if cur.panicReporter != nil {
+			return cur.panicReporter
+		}
+	}
+	return PanicHandler
+}
+
+// MultiPanicReporter returns a reporter that reports each panic to all of reporters, in order.
+// A reporter that panics doesn't keep the others from getting the report.
+// Structured reports are passed on as is to the reporters that implement StructuredPanicReporter.
+func MultiPanicReporter(reporters ...PanicReporter) PanicReporter {
+	return multiPanicReporter(append([]PanicReporter(nil), reporters...))
+}
+
+type multiPanicReporter []PanicReporter
+
+func (m multiPanicReporter) Panic(url string, err interface{}, stack string) {
+	m.ReportPanic(&PanicReport{URL: url, Value: err, Stack: stack})
+}
+
+func (m multiPanicReporter) ReportPanic(report *PanicReport) {
+	for _, reporter := range m {
+		reportTo(reporter, report)
+	}
+}
+
+// reportPanic reports a panic in the router r to its reporter.
+func reportPanic(r *Router, report *PanicReport) {
+	reportTo(r.panicReporterFor(), report)
+}
+
+// reportTo reports a panic to reporter.
+// If reporter panics, both panics are reported to the default reporter instead.
+func reportTo(reporter PanicReporter, report *PanicReport) {
+	defer func() {
+		if nested := recover(); nested != nil {
+			fallback := AdaptPanicReporter(defaultPanicReporter)
+			fallback.ReportPanic(report)
+			fallback.ReportPanic(&PanicReport{
+				URL:   report.URL,
+				Value: fmt.Sprintf("PanicHandler panicked: %v", nested),
+				Stack: fullStack(),
+			})
+		}
+	}()
+	AdaptPanicReporter(reporter).ReportPanic(report)
+}
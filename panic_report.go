@@ -0,0 +1,151 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// RequestIDHeader is the request header that PanicReport.RequestID is read from.
+var RequestIDHeader = "X-Request-Id"
+
+// RedactedHeaders are the request headers whose values are replaced with "[REDACTED]" in panic reports.
+var RedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// PanicReport describes a panic that happened while serving a request.
+// Server errors returned by handlers or middleware that no Error handler handled are reported too,
+// with the error as Value and without Stack and Frames.
+type PanicReport struct {
+	URL        string
+	Method     string
+	RoutePath  string            // The pattern of the route, e.g. "/users/:id", or "" if the request wasn't routed.
+	PathParams map[string]string // nil if the request wasn't routed.
+	RequestID  string            // The RequestIDHeader of the request, if any.
+	Header     http.Header       // The request headers, with RedactedHeaders redacted.
+	Value      interface{}       // The recovered value.
+	Stack      string            // The full stack of the goroutine that panicked.
+	Frames     []StackFrame      // The frames of Stack, starting with the innermost one.
+}
+
+// StackFrame is a function call in the stack of a PanicReport.
+type StackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// StructuredPanicReporter receives panics that happen when serving a request as structured reports.
+// PanicHandler can implement it instead of, or in addition to, PanicReporter.
+type StructuredPanicReporter interface {
+	ReportPanic(report *PanicReport)
+}
+
+// AdaptPanicReporter returns a StructuredPanicReporter that reports to r.
+// If r doesn't implement StructuredPanicReporter itself, r.Panic is called with the URL,
+// the recovered value and the full stack of each report.
+func AdaptPanicReporter(r PanicReporter) StructuredPanicReporter {
+	if s, ok := r.(StructuredPanicReporter); ok {
+		return s
+	}
+	return panicReporterAdapter{r}
+}
+
+type panicReporterAdapter struct {
+	PanicReporter
+}
+
+func (a panicReporterAdapter) ReportPanic(report *PanicReport) {
+	a.Panic(report.URL, report.Value, report.Stack)
+}
+
+// newPanicReport returns a report for the panic value that was recovered while serving req.
+// It has to be called from the deferred function that recovered, so the stack includes the frames that panicked.
+func newPanicReport(req *Request, value interface{}) *PanicReport {
+	report := newRequestReport(req, value)
+	report.Stack = fullStack()
+	report.Frames = panicFrames(stackFrames(3))
+	return report
+}
+
+// newRequestReport returns a report for value, without a stack.
+func newRequestReport(req *Request, value interface{}) *PanicReport {
+	report := &PanicReport{
+		URL:       fmt.Sprint(req.URL),
+		Method:    req.Method,
+		RoutePath: req.RoutePath(),
+		RequestID: req.Header.Get(RequestIDHeader),
+		Header:    redactedHeader(req.Header),
+		Value:     value,
+	}
+	if req.IsRouted() {
+		report.PathParams = req.PathParams
+	}
+	return report
+}
+
+func redactedHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range RedactedHeaders {
+		if values := redacted.Values(key); len(values) > 0 {
+			for i := range values {
+				values[i] = "[REDACTED]"
+			}
+		}
+	}
+	return redacted
+}
+
+// fullStack returns the stack of the calling goroutine.
+// Called from a deferred recover, it includes the frames that panicked.
+func fullStack() string {
+	stack := make([]byte, 4096)
+	for {
+		n := runtime.Stack(stack, false)
+		if n < len(stack) {
+			return string(stack[:n])
+		}
+		stack = make([]byte, 2*len(stack))
+	}
+}
+
+// panicFrames returns the frames of a stack captured while recovering from a panic,
+// starting with the function that panicked. The frames of the deferred recovery and of the runtime's
+// panic machinery (e.g. runtime.gopanic, runtime.panicdivide) are dropped.
+func panicFrames(frames []StackFrame) []StackFrame {
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].Function != "runtime.gopanic" {
+			continue
+		}
+		frames = frames[i+1:]
+		for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "runtime.") {
+			frames = frames[1:]
+		}
+		return frames
+	}
+	return frames
+}
+
+// stackFrames returns the frames of the calling goroutine, skipping the innermost skip frames
+// (with 0 identifying runtime.Callers itself).
+func stackFrames(skip int) []StackFrame {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+
+	var frames []StackFrame
+	iter := runtime.CallersFrames(pcs)
+	for {
+		frame, more := iter.Next()
+		frames = append(frames, StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return frames
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package grom
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingStructuredReporter struct {
+	reports *[]*PanicReport
+}
+
+func (r recordingStructuredReporter) Panic(url string, err interface{}, stack string) {
+	panic("Panic shouldn't be called on a StructuredPanicReporter")
+}
+
+func (r recordingStructuredReporter) ReportPanic(report *PanicReport) {
+	*r.reports = append(*r.reports, report)
+}
+
+func deepPanic(depth int) {
+	if depth == 0 {
+		panic("deep")
+	}
+	deepPanic(depth - 1)
+}
+
+func TestStructuredPanicReport(t *testing.T) {
+	var reports []*PanicReport
+	oldHandler := PanicHandler
+	PanicHandler = recordingStructuredReporter{reports: &reports}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.Get("/users/:id", (*Context).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/users/3?q=1")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("X-Request-Id", "abc123")
+	router.ServeHTTP(rw, req)
+
+	if !assert.Len(t, reports, 1) {
+		return
+	}
+	report := reports[0]
+	assert.Equal(t, "/users/3?q=1", report.URL)
+	assert.Equal(t, "GET", report.Method)
+	assert.Equal(t, "/users/:id", report.RoutePath)
+	assert.Equal(t, map[string]string{"id": "3"}, report.PathParams)
+	assert.Equal(t, "abc123", report.RequestID)
+	assert.Equal(t, "[REDACTED]", report.Header.Get("Authorization"))
+	assert.Equal(t, "[REDACTED]", report.Header.Get("Cookie"))
+	assert.Equal(t, "text/html", report.Header.Get("Accept"))
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	assert.Contains(t, report.Stack, "ErrorAction")
+
+	if assert.NotEmpty(t, report.Frames) {
+		assert.Equal(t, "github.com/pchchv/grom.(*Context).ErrorAction", report.Frames[0].Function)
+		assert.Contains(t, report.Frames[0].File, "grom_test.go")
+	}
+}
+
+func TestPanicReportFramesStartAtPanic(t *testing.T) {
+	var reports []*PanicReport
+	router := New(Context{}).PanicHandler(recordingStructuredReporter{reports: &reports})
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		deepPanic(2)
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	if assert.Len(t, reports, 1) && assert.True(t, len(reports[0].Frames) > 3) {
+		for _, frame := range reports[0].Frames[:3] {
+			assert.Equal(t, "github.com/pchchv/grom.deepPanic", frame.Function)
+		}
+	}
+}
+
+func TestPanicReportUnrouted(t *testing.T) {
+	var reports []*PanicReport
+	oldHandler := PanicHandler
+	PanicHandler = recordingStructuredReporter{reports: &reports}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.Middleware((*Context).ErrorMiddleware)
+	router.Get("/action", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "", reports[0].RoutePath)
+		assert.Nil(t, reports[0].PathParams)
+	}
+}
+
+func TestPanicReporterAdapterGetsFullStack(t *testing.T) {
+	var stack string
+	oldHandler := PanicHandler
+	PanicHandler = panicReporterFunc(func(url string, err interface{}, s string) {
+		stack = s
+	})
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		deepPanic(100)
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assert.True(t, len(stack) > 4096, "expected the full stack, got %d bytes", len(stack))
+	assert.True(t, strings.Contains(stack, "ServeHTTP"))
+}
+
+type panicReporterFunc func(url string, err interface{}, stack string)
+
+func (f panicReporterFunc) Panic(url string, err interface{}, stack string) {
+	f(url, err, stack)
+}
+
+func TestRouterPanicHandler(t *testing.T) {
+	var global, site, admin []interface{}
+	oldHandler := PanicHandler
+	PanicHandler = recordingPanicReporter{panics: &global}
+	defer func() {
+		PanicHandler = oldHandler
+	}()
+
+	router := New(Context{})
+	router.Get("/action", (*Context).ErrorAction)
+	api := router.Subrouter(APIContext{}, "/api")
+	api.PanicHandler(recordingPanicReporter{panics: &admin})
+	api.Get("/action", (*APIContext).ErrorAction)
+	nested := api.Subrouter(APIContext{}, "/nested")
+	nested.Get("/action", (*APIContext).ErrorAction)
+
+	other := New(Context{}).PanicHandler(recordingPanicReporter{panics: &site})
+	other.Get("/action", (*Context).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/api/action")
+	router.ServeHTTP(rw, req)
+	rw, req = newTestRequest("GET", "/api/nested/action")
+	router.ServeHTTP(rw, req)
+	rw, req = newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	rw, req = newTestRequest("GET", "/action")
+	other.ServeHTTP(rw, req)
+
+	assert.Len(t, admin, 2)
+	assert.Len(t, global, 1)
+	assert.Len(t, site, 1)
+}
+
+func TestMultiPanicReporter(t *testing.T) {
+	var first []interface{}
+	var reports []*PanicReport
+	var buf strings.Builder
+	oldDefault := defaultPanicReporter
+	defaultPanicReporter = logPanicReporter{log: log.New(&buf, "", 0)}
+	defer func() {
+		defaultPanicReporter = oldDefault
+	}()
+
+	router := New(Context{})
+	router.PanicHandler(MultiPanicReporter(
+		recordingPanicReporter{panics: &first},
+		panickingPanicReporter{},
+		recordingStructuredReporter{reports: &reports},
+	))
+	router.Get("/users/:id", (*Context).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", 500)
+
+	assert.Len(t, first, 1)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "/users/:id", reports[0].RoutePath)
+	}
+	assert.Contains(t, buf.String(), "PanicHandler panicked: reporter")
+}
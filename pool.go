@@ -0,0 +1,72 @@
+package grom
+
+import "reflect"
+
+// requestState holds the ResponseWriter and Request that are handed to middleware and handlers.
+// It is allocated for every request rather than pooled,
+// so handlers that hold on to them never see another request's data.
+type requestState struct {
+	appResponseWriter
+	Request
+}
+
+// acquireClosure returns a middlewareClosure for serving a request with the root router r.
+// The closure, its Routers and Contexts slices and the function that steps through the middleware
+// are reused between requests. Its Next function is made for each request.
+// The caller has to add the root context.
+func (r *Router) acquireClosure(state *requestState) *middlewareClosure {
+	closure, ok := r.closurePool.Get().(*middlewareClosure)
+	if !ok {
+		closure = &middlewareClosure{
+			Routers:    make([]*Router, 0, r.maxChildrenDepth),
+			Contexts:   make([]reflect.Value, 0, r.maxChildrenDepth),
+			RootRouter: r,
+		}
+		middlewareStack(closure)
+	}
+
+	closure.requestState = state
+	closure.Routers = append(closure.Routers[:0], r)
+	closure.Contexts = closure.Contexts[:0]
+	closure.currentMiddlewareIndex = 0
+	closure.currentRouterIndex = 0
+	closure.currentMiddlewareLen = len(r.middleware)
+	closure.routed = false
+	closure.Next = closure.nextFor(closure.generation.Load())
+	return closure
+}
+
+// releaseClosure returns the closure and any resettable contexts it allocated to their pools.
+// If the connection was hijacked, the handler may still be using its context,
+// so nothing is reused.
+func (r *Router) releaseClosure(closure *middlewareClosure) {
+	closure.generation.Add(1)
+	if closure.hijacked {
+		return
+	}
+
+	for i, ctx := range closure.Contexts {
+		if closure.allocatedContext(i) {
+			closure.Routers[i].releaseContext(ctx, &closure.Request)
+		}
+	}
+
+	for i := range closure.Contexts {
+		closure.Contexts[i] = reflect.Value{}
+	}
+
+	for i := range closure.Routers {
+		closure.Routers[i] = nil
+	}
+
+	// The Request may outlive the request, but the Contexts slice is reused.
+	closure.Request.contexts = nil
+	closure.requestState = nil
+	r.closurePool.Put(closure)
+}
+
+// allocatedContext returns true if Contexts[i] was allocated for Routers[i],
+// rather than shared with the parent router.
+func (closure *middlewareClosure) allocatedContext(i int) bool {
+	return i == 0 || closure.Routers[i].parentField >= 0
+}
@@ -0,0 +1,194 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ResettableContext struct {
+	Value  string
+	Resets int
+}
+
+func (c *ResettableContext) Reset() {
+	c.Value = ""
+	c.Resets++
+}
+
+type ResettableAdminContext struct {
+	*ResettableContext
+	Admin string
+}
+
+func (c *ResettableAdminContext) Reset() {
+	c.Admin = ""
+}
+
+func TestContextReset(t *testing.T) {
+	var root *ResettableContext
+	var admin *ResettableAdminContext
+	router := New(ResettableContext{})
+	router.Middleware(func(c *ResettableContext, rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		root = c
+		c.Value = "dirty"
+		next(rw, req)
+	})
+	router.Get("/action", func(c *ResettableContext, rw ResponseWriter, req *Request) {
+		fmt.Fprintf(rw, "value=%s", c.Value)
+	})
+	adminRouter := router.Subrouter(ResettableAdminContext{}, "/admin")
+	adminRouter.Get("/action", func(c *ResettableAdminContext, rw ResponseWriter, req *Request) {
+		admin = c
+		c.Admin = "dirty"
+		fmt.Fprintf(rw, "value=%s", c.Value)
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "value=dirty", http.StatusOK)
+	assert.Equal(t, "", root.Value)
+	assert.Equal(t, 1, root.Resets)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "value=dirty", http.StatusOK)
+	assert.Equal(t, "", root.Value)
+	assert.Equal(t, "", admin.Admin)
+}
+
+func TestContextNotResetAfterHijack(t *testing.T) {
+	var root *ResettableContext
+	router := New(ResettableContext{})
+	router.Get("/action", func(c *ResettableContext, rw ResponseWriter, req *Request) {
+		root = c
+		c.Value = "hijacked"
+		rw.Hijack()
+	})
+
+	_, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(&hijackableResponse{}, req)
+	assert.Equal(t, "hijacked", root.Value)
+	assert.Equal(t, 0, root.Resets)
+}
+
+type ResettableTicketsContext struct {
+	*ResettableContext
+	Ticket string
+}
+
+func TestPromotedResetIgnored(t *testing.T) {
+	var tickets *ResettableTicketsContext
+	router := New(ResettableContext{})
+	ticketsRouter := router.Subrouter(ResettableTicketsContext{}, "/tickets")
+	ticketsRouter.Get("/action", func(c *ResettableTicketsContext, rw ResponseWriter, req *Request) {
+		tickets = c
+		c.Ticket = "dirty"
+	})
+	assert.Nil(t, ticketsRouter.contextPool)
+
+	rw, req := newTestRequest("GET", "/tickets/action")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, 1, tickets.Resets)
+	assert.Equal(t, "dirty", tickets.Ticket)
+}
+
+type PanickingResetContext struct {
+	*Context
+	Value string
+}
+
+func (c *PanickingResetContext) Reset() {
+	panic("reset")
+}
+
+func TestContextResetPanic(t *testing.T) {
+	var retained ResponseWriter
+	var reports []*PanicReport
+	var contexts []*PanickingResetContext
+	router, misuses := strictRouter()
+	router.PanicHandler(recordingStructuredReporter{reports: &reports})
+	admin := router.Subrouter(PanickingResetContext{}, "/admin")
+	admin.Get("/action", func(c *PanickingResetContext, rw ResponseWriter, req *Request) {
+		retained = rw
+		contexts = append(contexts, c)
+		c.Value = "dirty"
+		fmt.Fprint(rw, "ok")
+	})
+
+	for i := 0; i < 2; i++ {
+		rw, req := newTestRequest("GET", "/admin/action")
+		assert.NotPanics(t, func() {
+			router.ServeHTTP(rw, req)
+		})
+		assertResponse(t, rw, "ok", http.StatusOK)
+	}
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, "reset", reports[0].Value)
+		assert.Equal(t, "github.com/pchchv/grom.(*PanickingResetContext).Reset", reports[0].Frames[0].Function)
+	}
+	// A context that failed to reset isn't reused.
+	assert.NotSame(t, contexts[0], contexts[1])
+
+	// The request was still marked as served.
+	fmt.Fprint(retained, "late")
+	if assert.Len(t, *misuses, 1) {
+		assert.Equal(t, ResponseWriterRetained, (*misuses)[0].Kind)
+	}
+}
+
+type BuilderContext struct {
+	strings.Builder
+	User string
+}
+
+func TestEmbeddedResetIgnored(t *testing.T) {
+	router := New(BuilderContext{})
+	router.Get("/set", func(c *BuilderContext, rw ResponseWriter, req *Request) {
+		c.User = "alice"
+	})
+	router.Get("/get", func(c *BuilderContext, rw ResponseWriter, req *Request) {
+		fmt.Fprintf(rw, "user=%s", c.User)
+	})
+	assert.Nil(t, router.contextPool)
+
+	rw, req := newTestRequest("GET", "/set")
+	router.ServeHTTP(rw, req)
+
+	rw, req = newTestRequest("GET", "/get")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "user=", http.StatusOK)
+}
+
+func TestRetainedNextIsStale(t *testing.T) {
+	var kept NextMiddlewareFunc
+	var keptRw ResponseWriter
+	var keptReq *Request
+	var actions []string
+	router := New(Context{})
+	router.Middleware(func(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		if kept == nil {
+			kept, keptRw, keptReq = next, rw, req
+		} else {
+			// The first request is over, and this one may be using its closure.
+			kept(keptRw, keptReq)
+		}
+		next(rw, req)
+	})
+	router.Get("/:name", func(rw ResponseWriter, req *Request) {
+		actions = append(actions, req.PathParams["name"])
+		fmt.Fprint(rw, req.PathParams["name"])
+	})
+
+	rw, req := newTestRequest("GET", "/first")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "first", 200)
+
+	rw, req = newTestRequest("GET", "/second")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "second", 200)
+	assert.Equal(t, []string{"first", "second"}, actions)
+}
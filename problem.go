@@ -0,0 +1,162 @@
+package grom
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of problem details documents (RFC 9457).
+const ProblemContentType = "application/problem+json"
+
+// Problem is a problem details document, as described in RFC 9457.
+// Handlers and middleware can return it or panic with it, like an HTTPError,
+// to control every member of the document rendered by routers that use ProblemDetails.
+type Problem struct {
+	// Type is a URI reference that identifies the problem type. It defaults to "about:blank".
+	Type string
+	// Title is a short summary of the problem type. It defaults to the status text.
+	Title string
+	// Status is the HTTP status code of the response.
+	Status int
+	// Detail explains this occurrence of the problem.
+	Detail string
+	// Instance is a URI reference that identifies this occurrence. It defaults to the request path.
+	Instance string
+	// Extensions are additional members of the document.
+	// They can't override the members above.
+	Extensions map[string]interface{}
+}
+
+// Error returns the title of the problem, followed by the detail if there is one.
+func (p *Problem) Error() string {
+	msg := p.title()
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+// MarshalJSON renders the problem as a JSON object, with the extension members next to the standard ones.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]interface{}, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		doc[key] = value
+	}
+	doc["type"] = p.Type
+	if p.Type == "" {
+		doc["type"] = "about:blank"
+	}
+	doc["title"] = p.title()
+	doc["status"] = p.Status
+	if p.Detail != "" {
+		doc["detail"] = p.Detail
+	} else {
+		delete(doc, "detail")
+	}
+	if p.Instance != "" {
+		doc["instance"] = p.Instance
+	} else {
+		delete(doc, "instance")
+	}
+	return json.Marshal(doc)
+}
+
+func (p *Problem) title() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return http.StatusText(p.Status)
+}
+
+// errorFormat is how a router renders the responses grom writes when there's no handler for them.
+type errorFormat int
+
+const (
+	// inheritErrorFormat uses the format of the parent router, or plain text on the root router.
+	inheritErrorFormat errorFormat = iota
+	textErrorFormat
+	problemErrorFormat
+)
+
+// ProblemDetails sets whether the router and its subrouters render their default error responses
+// as RFC 9457 problem details documents, and returns the router.
+// This covers routes that aren't found, methods that aren't allowed, panics, and returned errors
+// that aren't handled by an Error or NotFound handler.
+// A subrouter can turn it back off, e.g. to render HTML error pages under an API router.
+func (r *Router) ProblemDetails(enabled bool) *Router {
+	if enabled {
+		r.errorFormat = problemErrorFormat
+	} else {
+		r.errorFormat = textErrorFormat
+	}
+	return r
+}
+
+// rendersProblems returns true if the router renders its default error responses as problem details.
+func (r *Router) rendersProblems() bool {
+	for cur := r; cur != nil; cur = cur.parent {
+		if cur.errorFormat != inheritErrorFormat {
+			return cur.errorFormat == problemErrorFormat
+		}
+	}
+	return false
+}
+
+// routerForPath returns the deepest router in the tree of r whose path prefix matches path.
+func (r *Router) routerForPath(path string) *Router {
+	best := r
+	for _, child := range r.children {
+		if !pathHasPrefix(path, child.pathPrefix) {
+			continue
+		}
+		if candidate := child.routerForPath(path); len(candidate.pathPrefix) > len(best.pathPrefix) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// pathHasPrefix returns true if prefix is path or a parent segment of it.
+// A trailing slash in prefix, e.g. of a subrouter made with the prefix "" or "/admin/", is ignored.
+func pathHasPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix) && path[len(prefix)] == '/'
+}
+
+// problemFor returns the problem details for err, which is a panic or an error returned by a handler.
+// known is false if err doesn't carry a status, in which case it's a 500.
+func problemFor(err interface{}) (problem *Problem, known bool) {
+	if e, ok := err.(error); ok {
+		var p *Problem
+		if errors.As(e, &p) {
+			cp := *p
+			return &cp, true
+		}
+	}
+	if httpErr, ok := httpErrorOf(err); ok {
+		return &Problem{Status: httpErr.Status, Detail: httpErr.Message}, true
+	}
+	return &Problem{Status: http.StatusInternalServerError}, false
+}
+
+// writeProblem renders p for req.
+func writeProblem(rw ResponseWriter, req *Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = req.URL.Path
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		// Only extension members can fail to marshal.
+		body, _ = json.Marshal(&Problem{Status: p.Status, Type: p.Type, Title: p.Title, Detail: p.Detail, Instance: p.Instance})
+	}
+
+	rw.Header().Set("Content-Type", ProblemContentType)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(p.Status)
+	rw.Write(body)
+}
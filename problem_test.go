@@ -0,0 +1,148 @@
+package grom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProblem(t *testing.T, body []byte) map[string]interface{} {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid problem document %q: %v", body, err)
+	}
+	return doc
+}
+
+func problemRouter() *Router {
+	router := New(Context{})
+	router.Get("/", func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "home")
+	})
+	router.Get("/boom", (*Context).ErrorAction)
+
+	api := router.Subrouter(APIContext{}, "/api")
+	api.ProblemDetails(true)
+	api.Get("/users/:id", func(w ResponseWriter, r *Request) error {
+		return NotFound("no user " + r.PathParams["id"])
+	})
+	api.Get("/boom", (*APIContext).ErrorAction)
+	api.Get("/quota", func(w ResponseWriter, r *Request) error {
+		return &Problem{
+			Type:       "https://example.com/probs/out-of-credit",
+			Title:      "You do not have enough credit.",
+			Status:     http.StatusForbidden,
+			Detail:     "Your current balance is 30, but that costs 50.",
+			Extensions: map[string]interface{}{"balance": 30, "status": 200},
+		}
+	})
+
+	pages := api.Subrouter(APIContext{}, "/pages")
+	pages.ProblemDetails(false)
+	pages.Get("/boom", (*APIContext).ErrorAction)
+	return router
+}
+
+func TestProblemDetailsForErrors(t *testing.T) {
+	router := problemRouter()
+
+	rw, req := newTestRequest("GET", "/api/users/7")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, ProblemContentType, rw.Header().Get("Content-Type"))
+	assert.Equal(t, map[string]interface{}{
+		"type":     "about:blank",
+		"title":    "Not Found",
+		"status":   404.0,
+		"detail":   "no user 7",
+		"instance": "/api/users/7",
+	}, decodeProblem(t, rw.Body.Bytes()))
+
+	rw, req = newTestRequest("GET", "/api/boom")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+	assert.Equal(t, map[string]interface{}{
+		"type":     "about:blank",
+		"title":    "Internal Server Error",
+		"status":   500.0,
+		"instance": "/api/boom",
+	}, decodeProblem(t, rw.Body.Bytes()))
+
+	rw, req = newTestRequest("GET", "/api/quota")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	doc := decodeProblem(t, rw.Body.Bytes())
+	assert.Equal(t, "https://example.com/probs/out-of-credit", doc["type"])
+	assert.Equal(t, 403.0, doc["status"])
+	assert.Equal(t, 30.0, doc["balance"])
+}
+
+func TestProblemDetailsForUnroutedRequests(t *testing.T) {
+	router := problemRouter()
+
+	rw, req := newTestRequest("GET", "/api/nope")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, ProblemContentType, rw.Header().Get("Content-Type"))
+	assert.Equal(t, "Not Found", decodeProblem(t, rw.Body.Bytes())["title"])
+
+	rw, req = newTestRequest("DELETE", "/api/users/7")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	assert.Equal(t, "GET", rw.Header().Get("Allow"))
+	assert.Equal(t, "Method Not Allowed", decodeProblem(t, rw.Body.Bytes())["title"])
+
+	// Routers that didn't opt in keep the plain responses.
+	rw, req = newTestRequest("GET", "/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Not Found", http.StatusNotFound)
+
+	rw, req = newTestRequest("DELETE", "/")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Not Found", http.StatusNotFound)
+}
+
+func TestProblemDetailsOptOut(t *testing.T) {
+	router := problemRouter()
+
+	rw, req := newTestRequest("GET", "/boom")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+
+	rw, req = newTestRequest("GET", "/api/pages/boom")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Application Error", http.StatusInternalServerError)
+
+	rw, req = newTestRequest("GET", "/api/pages/nope")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Not Found", http.StatusNotFound)
+}
+
+func TestProblemDetailsWithErrorHandler(t *testing.T) {
+	router := problemRouter()
+	router.Error((*Context).ErrorHandler)
+
+	rw, req := newTestRequest("GET", "/api/boom")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "My Error", http.StatusInternalServerError)
+}
+
+func TestProblemError(t *testing.T) {
+	p := &Problem{Status: http.StatusConflict, Detail: "name is taken"}
+	assert.Equal(t, "Conflict: name is taken", p.Error())
+
+	var target *Problem
+	assert.True(t, errors.As(fmt.Errorf("saving: %w", p), &target))
+
+	router := New(Context{})
+	router.Get("/action", func(w ResponseWriter, r *Request) error {
+		return p
+	})
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "name is taken", http.StatusConflict)
+}
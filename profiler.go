@@ -0,0 +1,155 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProfilerOption configures the profiler of a router (see Router.Profiler).
+type ProfilerOption struct {
+	// ServerTiming adds a Server-Timing header to responses, with the time spent in each middleware
+	// and in the handler until the header was written.
+	ServerTiming bool
+	// OnProfile, if set, is called with the profile of each request once it has been served,
+	// e.g. to aggregate the timings in a metrics system.
+	OnProfile func(profile *RequestProfile)
+}
+
+// RequestProfile is the time spent serving a request, broken down by middleware.
+type RequestProfile struct {
+	Method    string
+	URL       string
+	RoutePath string // The pattern of the route, or "" if the request wasn't routed.
+	Status    int
+	Duration  time.Duration // The time it took ServeHTTP to serve the request.
+	Timings   []Timing      // The middleware and the handler, in the order they were invoked.
+}
+
+// Timing is the time spent in a middleware or handler.
+type Timing struct {
+	Name      string // The name of the middleware or handler function.
+	Handler   bool   // Whether it's the handler rather than middleware.
+	Inclusive time.Duration
+	Exclusive time.Duration // Not counting the time spent in next.
+}
+
+// Profiler enables profiling and returns the router. Each middleware and handler is timed,
+// both including and excluding the rest of the chain it calls with next,
+// without having to add timers to them. It can only be enabled on the root router.
+//
+//	router.Profiler(grom.ProfilerOption{
+//		ServerTiming: true,
+//		OnProfile: func(p *grom.RequestProfile) {
+//			for _, t := range p.Timings {
+//				middlewareDuration.WithLabelValues(t.Name).Observe(t.Exclusive.Seconds())
+//			}
+//		},
+//	})
+func (r *Router) Profiler(option ProfilerOption) *Router {
+	if r.parent != nil {
+		panic("You can only enable the Profiler on the root router.")
+	}
+	r.profilerOption = &option
+	return r
+}
+
+// requestProfiler times the middleware and handler of a request.
+type requestProfiler struct {
+	option  *ProfilerOption
+	start   time.Time
+	entries []profileEntry
+}
+
+type profileEntry struct {
+	name      string
+	handler   bool
+	start     time.Time
+	end       time.Time     // Zero while running.
+	nested    time.Duration // The time spent in next, once it returned.
+	nextStart time.Time     // Set while next is running.
+}
+
+func newRequestProfiler(option *ProfilerOption) *requestProfiler {
+	return &requestProfiler{option: option, start: time.Now()}
+}
+
+// enter starts timing the middleware or handler name. It returns a next function that stops
+// the clock while the rest of the chain runs, and a function to call when name returns.
+func (p *requestProfiler) enter(name string, handler bool, next NextMiddlewareFunc) (NextMiddlewareFunc, func()) {
+	i := len(p.entries)
+	p.entries = append(p.entries, profileEntry{name: name, handler: handler, start: time.Now()})
+	timedNext := func(rw ResponseWriter, req *Request) {
+		p.entries[i].nextStart = time.Now()
+		next(rw, req)
+		p.entries[i].nested += time.Since(p.entries[i].nextStart)
+		p.entries[i].nextStart = time.Time{}
+	}
+	return timedNext, func() {
+		p.entries[i].end = time.Now()
+	}
+}
+
+// timings returns the timings of the entries as of now. Those that are still running are timed until now.
+func (p *requestProfiler) timings(now time.Time) []Timing {
+	timings := make([]Timing, len(p.entries))
+	for i, entry := range p.entries {
+		end, nested := entry.end, entry.nested
+		if end.IsZero() {
+			end = now
+		}
+		if !entry.nextStart.IsZero() {
+			nested += now.Sub(entry.nextStart)
+		}
+		inclusive := end.Sub(entry.start)
+		timings[i] = Timing{Name: entry.name, Handler: entry.handler, Inclusive: inclusive, Exclusive: inclusive - nested}
+	}
+	return timings
+}
+
+// setServerTiming adds the Server-Timing header, just before the header is written.
+func (p *requestProfiler) setServerTiming(header http.Header) {
+	if !p.option.ServerTiming {
+		return
+	}
+	now := time.Now()
+	metrics := make([]string, 0, len(p.entries)+1)
+	for i, timing := range p.timings(now) {
+		metric := "mw" + strconv.Itoa(i)
+		if timing.Handler {
+			metric = "handler"
+		}
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%s;desc=%q", metric, milliseconds(timing.Exclusive), timing.Name))
+	}
+	metrics = append(metrics, "total;dur="+milliseconds(now.Sub(p.start)))
+	header.Add("Server-Timing", strings.Join(metrics, ", "))
+}
+
+// finish calls OnProfile with the profile of the request that was served.
+// A panic in OnProfile is reported to the PanicHandler of the root router r.
+func (p *requestProfiler) finish(r *Router, rw *appResponseWriter, req *Request) {
+	if p.option.OnProfile == nil {
+		return
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			reportPanic(r, newPanicReport(req, recovered))
+		}
+	}()
+
+	now := time.Now()
+	p.option.OnProfile(&RequestProfile{
+		Method:    req.Method,
+		URL:       fmt.Sprint(req.URL),
+		RoutePath: req.RoutePath(),
+		Status:    rw.finalStatusCode(),
+		Duration:  now.Sub(p.start),
+		Timings:   p.timings(now),
+	})
+}
+
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
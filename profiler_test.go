@@ -0,0 +1,104 @@
+package grom
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiler(t *testing.T) {
+	var profiles []*RequestProfile
+	router := New(Context{}).Profiler(ProfilerOption{
+		ServerTiming: true,
+		OnProfile: func(profile *RequestProfile) {
+			profiles = append(profiles, profile)
+		},
+	})
+	router.Middleware(LoggerMiddleware)
+	router.Middleware((*Context).mwHeader)
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Get("/users/:id", func(c *AdminContext, w ResponseWriter, r *Request) {
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, "user")
+	})
+
+	rw, req := newTestRequest("GET", "/admin/users/3")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, 200, rw.Code)
+
+	serverTiming := rw.Header().Get("Server-Timing")
+	assert.Regexp(t, `^mw0;dur=\d+\.\d{3};desc="github.com/pchchv/grom.LoggerMiddleware", `+
+		`mw1;dur=\d+\.\d{3};desc="github.com/pchchv/grom.\(\*Context\).mwHeader", `+
+		`handler;dur=\d+\.\d{3};desc="github.com/pchchv/grom.TestProfiler.func2", total;dur=\d+\.\d{3}$`, serverTiming)
+
+	if !assert.Len(t, profiles, 1) {
+		return
+	}
+	profile := profiles[0]
+	assert.Equal(t, "GET", profile.Method)
+	assert.Equal(t, "/admin/users/:id", profile.RoutePath)
+	assert.Equal(t, 200, profile.Status)
+	if assert.Len(t, profile.Timings, 3) {
+		logger, header, handler := profile.Timings[0], profile.Timings[1], profile.Timings[2]
+		assert.Equal(t, "github.com/pchchv/grom.LoggerMiddleware", logger.Name)
+		assert.False(t, logger.Handler)
+		assert.True(t, handler.Handler)
+		assert.True(t, handler.Exclusive >= 5*time.Millisecond)
+		assert.Equal(t, handler.Inclusive, handler.Exclusive)
+		assert.True(t, header.Inclusive >= handler.Inclusive)
+		assert.True(t, header.Exclusive <= header.Inclusive-handler.Inclusive)
+		assert.True(t, logger.Inclusive >= header.Inclusive)
+		assert.True(t, profile.Duration >= logger.Inclusive)
+	}
+}
+
+func TestProfilerServerTimingWithoutWrite(t *testing.T) {
+	router := New(Context{}).Profiler(ProfilerOption{ServerTiming: true})
+	router.Get("/action", func(w ResponseWriter, r *Request) {})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assert.Regexp(t, `^handler;dur=\d+\.\d{3};desc=".*TestProfilerServerTimingWithoutWrite.func1", total;dur=\d+\.\d{3}$`, rw.Header().Get("Server-Timing"))
+
+	rw, req = newTestRequest("GET", "/missing")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "Not Found", 404)
+	assert.Regexp(t, `^total;dur=\d+\.\d{3}$`, rw.Header().Get("Server-Timing"))
+
+	assert.Panics(t, func() {
+		router.Subrouter(Context{}, "/sub").Profiler(ProfilerOption{})
+	})
+}
+
+func TestPanickingOnProfile(t *testing.T) {
+	var retained ResponseWriter
+	var reports []*PanicReport
+	router, misuses := strictRouter()
+	router.PanicHandler(recordingStructuredReporter{reports: &reports})
+	router.Profiler(ProfilerOption{
+		OnProfile: func(profile *RequestProfile) {
+			panic("OnProfile")
+		},
+	})
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		retained = w
+		fmt.Fprint(w, "ok")
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	assert.NotPanics(t, func() {
+		router.ServeHTTP(rw, req)
+	})
+	assertResponse(t, rw, "ok", 200)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "OnProfile", reports[0].Value)
+	}
+
+	// The request was still marked as served.
+	fmt.Fprint(retained, "late")
+	if assert.Len(t, *misuses, 1) {
+		assert.Equal(t, ResponseWriterRetained, (*misuses)[0].Kind)
+	}
+}
@@ -1,6 +1,7 @@
 package grom
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 )
@@ -13,14 +14,20 @@ type Request struct {
 	// PathParams exists if you have wildcards in your URL that you need to capture.
 	// Eg, /users/:id/tickets/:ticket_id and /users/1/tickets/33 would yield the map {id: "3", ticket_id: "33"}
 	PathParams    map[string]string
-	route         *route        // The actual route that got invoked.
-	rootContext   reflect.Value // Root context. Set immediately.
-	targetContext reflect.Value // The target context corresponding to the route. Not set until root middleware is done.
+	route         *route          // The actual route that got invoked.
+	notFound      bool            // Whether route is the NotFound handler of a router rather than a matching route.
+	rootContext   reflect.Value   // Root context. Set immediately.
+	targetContext reflect.Value   // The target context corresponding to the route. Not set until root middleware is done.
+	contexts      []reflect.Value // [root context, ..., target context]. Only the root context until the request is routed.
+	panicStack    string          // The stack of the panic being handled, if any. See PanicStack.
 }
 
+type requestContextKey struct{}
+
 // IsRouted can be called from middleware to determine if the request has been routed yet.
+// It stays false if no route matches, including in the middleware that runs before a NotFound handler.
 func (r *Request) IsRouted() bool {
-	return r.route != nil
+	return r.route != nil && !r.notFound
 }
 
 // RoutePath returns the routed path string, e.g. if a route was registered with
@@ -32,3 +39,82 @@ func (r *Request) RoutePath() string {
 	}
 	return ""
 }
+
+// AllowedMethods returns the methods other than OPTIONS that have a route for the request path.
+// It lets an OPTIONS route added with Router.Options answer like the automatic OPTIONS handling would.
+func (r *Request) AllowedMethods() []string {
+	if r.route == nil {
+		return nil
+	}
+	return r.route.Router.allowedMethods(r.URL.Path)
+}
+
+// PanicStack returns the stack trace of the panic that is being handled,
+// so error handlers can log it. It is empty if the request didn't panic,
+// including when the error was returned by a handler or middleware.
+func (r *Request) PanicStack() string {
+	return r.panicStack
+}
+
+// Context returns the request's context.Context, which carries the grom Request,
+// so code that only receives the context.Context can use FromContext to get to
+// the route, the path params and the app contexts (see ContextOf).
+// Unless the context of Request.Request carries the grom Request already (see Router.StoreRequestInContext),
+// the returned context is derived from it to carry it. Context doesn't change the request.
+func (r *Request) Context() context.Context {
+	ctx := r.Request.Context()
+	if req, _ := ctx.Value(requestContextKey{}).(*Request); req != r {
+		ctx = context.WithValue(ctx, requestContextKey{}, r)
+	}
+	return ctx
+}
+
+// WithContext changes the context of the request to ctx and returns the updated *http.Request,
+// which Request.Request is set to, so later middleware and handlers see the new context.
+// Like Context, ctx is made to carry the grom Request.
+func (r *Request) WithContext(ctx context.Context) *http.Request {
+	if req, _ := ctx.Value(requestContextKey{}).(*Request); req != r {
+		ctx = context.WithValue(ctx, requestContextKey{}, r)
+	}
+	r.Request = r.Request.WithContext(ctx)
+	return r.Request
+}
+
+// StoreRequestInContext sets whether the router stores each grom Request in the context of
+// Request.Request when it starts serving it, and returns the router. This lets code that is only handed
+// the *http.Request, e.g. a wrapped net/http handler, use FromContext(req.Context()) on it.
+// It costs a copy of the *http.Request and a context value on every request, so it's off by default.
+// It can only be enabled on the root router.
+func (r *Router) StoreRequestInContext(enabled bool) *Router {
+	if r.parent != nil {
+		panic("You can only store the Request in the context on the root router.")
+	}
+	r.requestInContext = enabled
+	return r
+}
+
+// FromContext returns the grom Request carried by ctx, which is derived from Request.Context.
+// It allows code deep in a service layer to look up the route (RoutePath), the path params
+// and the app contexts (ContextOf) of the request it's serving.
+func FromContext(ctx context.Context) (*Request, bool) {
+	req, ok := ctx.Value(requestContextKey{}).(*Request)
+	return req, ok
+}
+
+// ContextOf returns the context of type T for the request, if there is one.
+// T is usually a pointer to one of your context types, e.g. ContextOf[*AdminContext](req),
+// but it can also be an interface that one of your contexts implements.
+// The innermost matching context is returned.
+// Contexts from subrouters are only available once the request has been routed (see IsRouted),
+// and no contexts are available once the request has completed.
+// This allows generic middleware to read fields of application contexts.
+func ContextOf[T any](req *Request) (T, bool) {
+	for i := len(req.contexts) - 1; i >= 0; i-- {
+		if ctx, ok := req.contexts[i].Interface().(T); ok {
+			return ctx, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
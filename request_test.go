@@ -0,0 +1,133 @@
+package grom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type adminNamer interface {
+	AdminName() string
+}
+
+func (c *AdminContext) AdminName() string {
+	return "admin"
+}
+
+// contextReportingMiddleware is generic middleware that reads app contexts.
+func contextReportingMiddleware(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+	_, rootOk := ContextOf[*Context](req)
+	_, adminOk := ContextOf[*AdminContext](req)
+	fmt.Fprintf(rw, "root=%t admin=%t ", rootOk, adminOk)
+	next(rw, req)
+}
+
+func TestContextOf(t *testing.T) {
+	router := New(Context{})
+	router.Middleware(contextReportingMiddleware)
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Middleware(contextReportingMiddleware)
+	tickets := admin.Subrouter(TicketsContext{}, "/tickets")
+	tickets.Get("/action", func(rw ResponseWriter, req *Request) {
+		namer, ok := ContextOf[adminNamer](req)
+		fmt.Fprintf(rw, "namer=%t %s", ok, namer.AdminName())
+	})
+
+	rw, req := newTestRequest("GET", "/admin/tickets/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root=true admin=false root=true admin=true namer=true admin", http.StatusOK)
+}
+
+func TestContextOfAfterRequest(t *testing.T) {
+	var retained *Request
+	router := New(Context{})
+	router.Get("/action", func(rw ResponseWriter, req *Request) {
+		retained = req
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	_, ok := ContextOf[*Context](retained)
+	assert.False(t, ok)
+}
+
+type traceKey struct{}
+
+// describeRequest stands in for service code that only receives a context.Context.
+func describeRequest(ctx context.Context) string {
+	req, ok := FromContext(ctx)
+	if !ok {
+		return "no request"
+	}
+
+	admin, _ := ContextOf[*AdminContext](req)
+	return fmt.Sprintf("%s id=%s admin=%t trace=%v", req.RoutePath(), req.PathParams["id"], admin != nil, ctx.Value(traceKey{}))
+}
+
+func TestFromContext(t *testing.T) {
+	router := New(Context{})
+	router.Middleware(func(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		req.WithContext(context.WithValue(req.Context(), traceKey{}, "abc"))
+		next(rw, req)
+	})
+	admin := router.Subrouter(AdminContext{}, "/admin")
+	admin.Get("/users/:id", func(rw ResponseWriter, req *Request) {
+		fmt.Fprint(rw, describeRequest(req.Context()))
+	})
+	admin.Get("/raw/:id", func(rw ResponseWriter, req *Request) {
+		// The underlying *http.Request carries the same context.
+		fmt.Fprint(rw, describeRequest(req.Request.Context()))
+	})
+
+	rw, req := newTestRequest("GET", "/admin/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "/admin/users/:id id=3 admin=true trace=abc", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/raw/4")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "/admin/raw/:id id=4 admin=true trace=abc", http.StatusOK)
+
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestFromContextWithoutContextCall(t *testing.T) {
+	router := New(Context{})
+	router.Get("/users/:id", func(rw ResponseWriter, req *Request) {
+		// Service code that is handed the *http.Request, e.g. by a wrapped net/http handler.
+		fmt.Fprint(rw, describeRequest(req.Request.Context()))
+	})
+
+	rw, req := newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "no request", http.StatusOK)
+
+	router.StoreRequestInContext(true)
+	rw, req = newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "/users/:id id=3 admin=false trace=<nil>", http.StatusOK)
+
+	assert.Panics(t, func() {
+		router.Subrouter(Context{}, "/sub").StoreRequestInContext(true)
+	})
+}
+
+func TestContextConcurrentReads(t *testing.T) {
+	router := New(Context{})
+	router.Get("/users/:id", func(rw ResponseWriter, req *Request) {
+		results := make(chan string, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				results <- describeRequest(req.Context())
+			}()
+		}
+		fmt.Fprint(rw, <-results, " ", <-results)
+	})
+
+	rw, req := newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "/users/:id id=3 admin=false trace=<nil> /users/:id id=3 admin=false trace=<nil>", http.StatusOK)
+}
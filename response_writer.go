@@ -25,10 +25,21 @@ type appResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	size       int
+	hijacked   bool
+	// Checks the use of the ResponseWriter in strict mode. nil otherwise.
+	diagnostics *diagnostics
+	// Adds the Server-Timing header if the profiler is enabled. nil otherwise.
+	profiler *requestProfiler
 }
 
 // Don't need this yet because we get it for free:
 func (w *appResponseWriter) Write(data []byte) (n int, err error) {
+	if w.diagnostics != nil {
+		w.diagnostics.checkWrite()
+	}
+	if w.profiler != nil && w.statusCode == 0 {
+		w.profiler.setServerTiming(w.ResponseWriter.Header())
+	}
 	if w.statusCode == 0 {
 		w.statusCode = http.StatusOK
 	}
@@ -39,14 +50,36 @@ func (w *appResponseWriter) Write(data []byte) (n int, err error) {
 }
 
 func (w *appResponseWriter) WriteHeader(statusCode int) {
+	if w.diagnostics != nil {
+		w.diagnostics.checkWriteHeader()
+	}
+	if w.profiler != nil && w.statusCode == 0 {
+		w.profiler.setServerTiming(w.ResponseWriter.Header())
+	}
 	w.statusCode = statusCode
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (w *appResponseWriter) Header() http.Header {
+	if w.diagnostics != nil {
+		w.diagnostics.checkUse()
+	}
+	return w.ResponseWriter.Header()
+}
+
 func (w *appResponseWriter) Written() bool {
 	return w.statusCode != 0
 }
 
+// finalStatusCode returns the status code of the response once the request has been served.
+// If none was written, net/http writes 200 unless the connection was hijacked.
+func (w *appResponseWriter) finalStatusCode() int {
+	if w.statusCode == 0 && !w.hijacked {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
 func (w *appResponseWriter) Size() int {
 	return w.size
 }
@@ -60,12 +93,31 @@ func (w *appResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if !ok {
 		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
 	}
-	return hijacker.Hijack()
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, buf, err
 }
 
 func (w *appResponseWriter) Flush() {
+	if w.diagnostics != nil {
+		w.diagnostics.checkWrite()
+	}
+	if w.profiler != nil && w.statusCode == 0 {
+		w.profiler.setServerTiming(w.ResponseWriter.Header())
+	}
 	flusher, ok := w.ResponseWriter.(http.Flusher)
 	if ok {
 		flusher.Flush()
 	}
 }
+
+// CloseNotify returns a nil channel, which never receives, if the underlying ResponseWriter doesn't support it.
+func (w *appResponseWriter) CloseNotify() <-chan bool {
+	notifier, ok := w.ResponseWriter.(http.CloseNotifier)
+	if !ok {
+		return nil
+	}
+	return notifier.CloseNotify()
+}
@@ -117,3 +117,12 @@ func TestResponseWriterCloseNotify(t *testing.T) {
 	}
 	assert.True(t, closed)
 }
+
+func TestResponseWriterCloseNotifyUnsupported(t *testing.T) {
+	rw := ResponseWriter(&appResponseWriter{ResponseWriter: httptest.NewRecorder()})
+	var notifier <-chan bool
+	assert.NotPanics(t, func() {
+		notifier = rw.(http.CloseNotifier).CloseNotify()
+	})
+	assert.Nil(t, notifier)
+}
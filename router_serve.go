@@ -1,10 +1,12 @@
 package grom
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"reflect"
-	"runtime"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -15,90 +17,216 @@ var (
 )
 
 type middlewareClosure struct {
-	appResponseWriter
-	Request
+	*requestState
 	Routers                []*Router
 	Contexts               []reflect.Value
 	currentMiddlewareIndex int
 	currentRouterIndex     int
 	currentMiddlewareLen   int
+	routed                 bool // Whether the route has been calculated.
 	RootRouter             *Router
-	Next                   NextMiddlewareFunc
+	// Next is handed to middleware. It's made for each request and does nothing once the request is over,
+	// so middleware that keeps it can't step through the middleware of the request that reuses the closure.
+	Next NextMiddlewareFunc
+	// step advances the middleware stack. It's made once and reused with the closure (see middlewareStack).
+	step NextMiddlewareFunc
+	// Changes when the closure is released, which makes the Next of the previous request stale.
+	generation atomic.Uint64
 }
 
-func (mw *middlewareHandler) invoke(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+func (mw *middlewareHandler) invoke(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
 	if mw.Generic {
 		mw.GenericMiddleware(rw, req, next)
-	} else {
-		mw.DynamicMiddleware.Call([]reflect.Value{ctx, reflect.ValueOf(rw), reflect.ValueOf(req), reflect.ValueOf(next)})
+		return nil
+	} else if mw.ContextMiddleware != nil {
+		return mw.ContextMiddleware(ctx, rw, req, next)
 	}
+	return errorResult(mw.DynamicMiddleware.Call([]reflect.Value{ctx, reflect.ValueOf(rw), reflect.ValueOf(req), reflect.ValueOf(next)}))
+}
+
+func (h *actionHandler) invoke(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+	if h.Generic {
+		h.GenericHandler(rw, req)
+		return nil
+	} else if h.ContextHandler != nil {
+		return h.ContextHandler(ctx, rw, req)
+	}
+	return errorResult(h.DynamicHandler.Call([]reflect.Value{ctx, reflect.ValueOf(rw), reflect.ValueOf(req)}))
+}
+
+// invokeMiddleware invokes mw with the Next function of the closure,
+// through the profiler and strict mode checks if they're enabled.
+func (closure *middlewareClosure) invokeMiddleware(mw *middlewareHandler, ctx reflect.Value, rw ResponseWriter, req *Request) error {
+	next := closure.Next
+	if p := closure.profiler; p != nil {
+		var exit func()
+		next, exit = p.enter(mw.Name, false, next)
+		defer exit()
+	}
+	if d := closure.diagnostics; d != nil {
+		return d.invokeMiddleware(mw, ctx, rw, req, next)
+	}
+	return mw.invoke(ctx, rw, req, next)
+}
+
+// invokeHandler invokes the handler h, through the profiler and strict mode checks if they're enabled.
+func (closure *middlewareClosure) invokeHandler(h *actionHandler, ctx reflect.Value, rw ResponseWriter, req *Request) error {
+	if p := closure.profiler; p != nil {
+		_, exit := p.enter(h.Name, true, nil)
+		defer exit()
+	}
+	if d := closure.diagnostics; d != nil {
+		return d.invokeHandler(h, ctx, rw, req)
+	}
+	return h.invoke(ctx, rw, req)
+}
+
+// errorResult returns the error returned by a handler or middleware called through reflection, if any.
+func errorResult(results []reflect.Value) error {
+	if len(results) == 0 || results[0].IsNil() {
+		return nil
+	}
+	return results[0].Interface().(error)
 }
 
 // If there's a panic in the root middleware (so that we don't have a route/target),
 // then invoke the root handler or default.
 // If there's a panic in other middleware, then invoke the target action's function.
 // If there's a panic in the action handler, then invoke the target action's function.
-func (rootRouter *Router) handlePanic(rw *appResponseWriter, req *Request, err interface{}) {
-	var targetRouter *Router  // This will be set to the router we want to use the errorHandler on.
-	var context reflect.Value // this is the context of the target router
-	if req.route == nil {
-		targetRouter = rootRouter
-		context = req.rootContext
-	} else {
-		targetRouter = req.route.Router
-		context = req.targetContext
-		for !targetRouter.errorHandler.IsValid() && targetRouter.parent != nil {
-			targetRouter = targetRouter.parent
-			// Need to set context to the next context, UNLESS the context is the same type.
-			curContextStruct := reflect.Indirect(context)
-			if targetRouter.contextType != curContextStruct.Type() {
-				context = curContextStruct.Field(0)
-				if reflect.Indirect(context).Type() != targetRouter.contextType {
-					panic("bug: shouldn't get here")
-				}
+// If the error handler panics too, both panics are reported and the default response is written.
+// It returns true if the request has to be aborted with http.ErrAbortHandler.
+func (rootRouter *Router) handlePanic(closure *middlewareClosure, rw *appResponseWriter, req *Request, err interface{}) (abort bool) {
+	report := newPanicReport(req, err)
+	req.panicStack = report.Stack
+
+	start := 0
+	if req.route != nil {
+		start = len(closure.Routers) - 1
+	}
+
+	func() {
+		defer func() {
+			nested := recover()
+			if nested == nil {
+				return
 			}
-		}
+			if nested == http.ErrAbortHandler {
+				abort = true
+				return
+			}
+			nestedReport := newPanicReport(req, nested)
+			reportPanic(closure.Routers[start], nestedReport)
+			rootRouter.observePanic(req, nestedReport)
+			writeError(rw, req, nested, closure.Routers[start].rendersProblems())
+		}()
+		closure.handleError(rw, req, start, err)
+	}()
+
+	// Client errors are part of the normal flow of a request.
+	if !expectedError(err) {
+		reportPanic(closure.Routers[start], report)
+		rootRouter.observePanic(req, report)
 	}
+	return abort
+}
+
+// handleError invokes the error handler of the router at index start, or of its nearest ancestor that has one.
+// Routers and Contexts line up from the root router to the route's router.
+// If the error handler returns an error, that error is passed on to the next error handler up.
+// If no error handler handles it, the default response is written and the unhandled error is returned.
+// If no error handler is left, the default response for err is written (see HTTPError).
+func (closure *middlewareClosure) handleError(rw ResponseWriter, req *Request, start int, err interface{}) (unhandled interface{}) {
+	for i := start; i >= 0; i-- {
+		targetRouter := closure.Routers[i]
+		if !targetRouter.errorHandler.IsValid() {
+			continue
+		}
+
+		// The context is missing if building the root context panicked.
+		var context reflect.Value
+		if i < len(closure.Contexts) {
+			context = closure.Contexts[i]
+		}
+		if !context.IsValid() {
+			context = reflect.New(targetRouter.contextType)
+		}
 
-	if targetRouter.errorHandler.IsValid() {
-		invoke(targetRouter.errorHandler, context, []reflect.Value{reflect.ValueOf(rw), reflect.ValueOf(req), reflect.ValueOf(err)})
-	} else {
-		http.Error(rw, DefaultPanicResponse, http.StatusInternalServerError)
+		reraised := errorResult(invoke(targetRouter.errorHandler, context, []reflect.Value{reflect.ValueOf(rw), reflect.ValueOf(req), reflect.ValueOf(&err).Elem()}))
+		if reraised == nil {
+			return nil
+		}
+		err = reraised
 	}
 
-	const size = 4096
-	stack := make([]byte, size)
-	stack = stack[:runtime.Stack(stack, false)]
+	writeError(rw, req, err, closure.Routers[start].rendersProblems())
+	return err
+}
 
-	PanicHandler.Panic(fmt.Sprint(req.URL), err, string(stack))
+// handleReturnedError handles an error returned by a handler or middleware of the router at index start.
+// Server errors that no error handler handles are reported like panics, but without a stack.
+func (closure *middlewareClosure) handleReturnedError(rw ResponseWriter, req *Request, start int, err error) {
+	if unhandled := closure.handleError(rw, req, start, err); unhandled != nil && !expectedError(unhandled) {
+		report := newRequestReport(req, unhandled)
+		reportPanic(closure.Routers[start], report)
+		closure.RootRouter.observePanic(req, report)
+	}
 }
 
 // ServeHTTP is the entry point for servering all requests.
 func (rootRouter *Router) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
-	// Manually create a closure. These variables are needed in middlewareStack.
-	// The reason we put these here instead of in the middleware stack, is Go (as of 1.2)
-	// creates a heap variable for each varaiable in the closure. To minimize that, we'll
-	// just have one (closure *middlewareClosure).
-	var closure middlewareClosure
-	closure.Request.Request = r
-	closure.appResponseWriter.ResponseWriter = rw
-	closure.Routers = make([]*Router, 1, rootRouter.maxChildrenDepth)
-	closure.Routers[0] = rootRouter
-	closure.Contexts = make([]reflect.Value, 1, rootRouter.maxChildrenDepth)
-	closure.Contexts[0] = reflect.New(rootRouter.contextType)
-	closure.currentMiddlewareLen = len(rootRouter.middleware)
-	closure.RootRouter = rootRouter
-	closure.Request.rootContext = closure.Contexts[0]
+	// The variables needed by middlewareStack live in a middlewareClosure rather than in a Go closure,
+	// which would allocate a heap variable for each of them. The middlewareClosure is pooled, but the
+	// ResponseWriter and Request in requestState are allocated for each request, since handlers may keep them,
+	// and so is the closure's Next, which has to go stale once the request is over.
+	state := &requestState{}
+	state.Request.Request = r
+	if rootRouter.requestInContext {
+		state.Request.Request = r.WithContext(context.WithValue(r.Context(), requestContextKey{}, &state.Request))
+	}
+	state.appResponseWriter.ResponseWriter = rw
+	if rootRouter.misuseReporter != nil {
+		state.appResponseWriter.diagnostics = newDiagnostics(rootRouter.misuseReporter, state)
+	}
+	if rootRouter.profilerOption != nil {
+		state.appResponseWriter.profiler = newRequestProfiler(rootRouter.profilerOption)
+	}
+	closure := rootRouter.acquireClosure(state)
+	var start time.Time
+	if len(rootRouter.observers) > 0 {
+		start = time.Now()
+	}
 
 	// Handle errors
+	// http.ErrAbortHandler aborts the response without being reported,
+	// so it's passed on to net/http once the contexts are finished.
 	defer func() {
-		if recovered := recover(); recovered != nil {
-			rootRouter.handlePanic(&closure.appResponseWriter, &closure.Request, recovered)
+		recovered := recover()
+		abort := recovered == http.ErrAbortHandler
+		if recovered != nil && !abort {
+			abort = rootRouter.handlePanic(closure, &state.appResponseWriter, &state.Request, recovered)
+		}
+		finishContexts(closure, &state.appResponseWriter, &state.Request, recovered)
+		if p := state.appResponseWriter.profiler; p != nil {
+			if !state.appResponseWriter.Written() && !state.appResponseWriter.hijacked {
+				p.setServerTiming(rw.Header())
+			}
+			p.finish(rootRouter, &state.appResponseWriter, &state.Request)
+		}
+		rootRouter.observeResponseComplete(&state.Request, &state.appResponseWriter, start)
+		rootRouter.releaseClosure(closure)
+		if d := state.appResponseWriter.diagnostics; d != nil {
+			d.served.Store(true)
+		}
+		if abort {
+			panic(http.ErrAbortHandler)
 		}
 	}()
 
-	next := middlewareStack(&closure)
-	next(&closure.appResponseWriter, &closure.Request)
+	rootRouter.observeRequestStart(&state.Request)
+	closure.Contexts = append(closure.Contexts, rootRouter.newContext(reflect.Value{}, &state.Request))
+	state.Request.rootContext = closure.Contexts[0]
+	state.Request.contexts = closure.Contexts
+	closure.Next(&state.appResponseWriter, &state.Request)
 }
 
 // routersFor returns [root router, child router, ..., leaf route's router]
@@ -126,31 +254,52 @@ func routersFor(route *route, routers []*Router) []*Router {
 // routers is [root, child, ..., leaf] with at least 1 element
 // Returns [ctx for root, ... ctx for leaf]
 // NOTE: if two routers have the same contextType, then they'll share the exact same context.
-func contextsFor(contexts []reflect.Value, routers []*Router) []reflect.Value {
+func contextsFor(contexts []reflect.Value, routers []*Router, req *Request) []reflect.Value {
 	routersLen := len(routers)
 	for i := 1; i < routersLen; i++ {
 		var ctx reflect.Value
-		if routers[i].contextType == routers[i-1].contextType {
+		if routers[i].parentField < 0 {
 			ctx = contexts[i-1]
 		} else {
-			ctx = reflect.New(routers[i].contextType)
-			// set the first field to the parent
-			f := reflect.Indirect(ctx).Field(0)
-			f.Set(contexts[i-1])
+			ctx = routers[i].newContext(contexts[i-routers[i].parentDepth], req)
 		}
 		contexts = append(contexts, ctx)
 	}
 	return contexts
 }
 
-func invoke(handler reflect.Value, ctx reflect.Value, values []reflect.Value) {
+// notFoundRouter returns the router itself or its nearest parent that has a NotFound handler, or nil if there is none.
+func (r *Router) notFoundRouter() *Router {
+	for cur := r; cur != nil; cur = cur.parent {
+		if cur.notFoundHandler != nil {
+			return cur
+		}
+	}
+	return nil
+}
+
+// allowedMethods returns the methods other than OPTIONS that have a route for path.
+// Since all routers of a tree share the route trees, it can be called on any of them.
+func (r *Router) allowedMethods(path string) []string {
+	var methods []string
+	for _, method := range httpMethods {
+		if method == httpMethodOptions {
+			continue
+		}
+		if leaf, _ := r.root[method].Match(path); leaf != nil {
+			methods = append(methods, string(method))
+		}
+	}
+	return methods
+}
+
+func invoke(handler reflect.Value, ctx reflect.Value, values []reflect.Value) []reflect.Value {
 	numIn := handler.Type().NumIn()
 	if numIn == len(values) {
-		handler.Call(values)
-	} else {
-		values = append([]reflect.Value{ctx}, values...)
-		handler.Call(values)
+		return handler.Call(values)
 	}
+	values = append([]reflect.Value{ctx}, values...)
+	return handler.Call(values)
 }
 
 func calculateRoute(rootRouter *Router, req *Request) (*route, map[string]string) {
@@ -176,6 +325,15 @@ func calculateRoute(rootRouter *Router, req *Request) (*route, map[string]string
 	return leaf.route, wildcardMap
 }
 
+// currentMiddleware returns the middleware that is being run: that of the current router,
+// or the routed middleware of the root router once the request has been routed.
+func (closure *middlewareClosure) currentMiddleware() []*middlewareHandler {
+	if closure.currentRouterIndex == 0 && closure.routed {
+		return closure.RootRouter.routedMiddleware
+	}
+	return closure.Routers[closure.currentRouterIndex].middleware
+}
+
 // middlewareStack executes the middleware stack.
 // It does so creating/returning an anonymous function/closure.
 // This closure can be called multiple times (eg, next()).
@@ -183,11 +341,11 @@ func calculateRoute(rootRouter *Router, req *Request) (*route, map[string]string
 // Each time a middleware is called, this 'next' function is passed into it, which will/might call it again.
 // There are two 'virtual' middlewares in this stack: the route choosing middleware, and the action invoking middleware.
 // The route choosing middleware is executed after all root middleware.
-// It picks the route.
+// It picks the route. The root router's routed middleware is executed right after it.
 // The action invoking middleware is executed after all middleware.
 // It executes the final handler.
 func middlewareStack(closure *middlewareClosure) NextMiddlewareFunc {
-	closure.Next = func(rw ResponseWriter, req *Request) {
+	closure.step = func(rw ResponseWriter, req *Request) {
 		if closure.currentRouterIndex >= len(closure.Routers) {
 			return
 		}
@@ -198,77 +356,80 @@ func middlewareStack(closure *middlewareClosure) NextMiddlewareFunc {
 		//  - calculate route, setting routers/contexts, and fields in req.
 		var middleware *middlewareHandler
 		if closure.currentMiddlewareIndex < closure.currentMiddlewareLen {
-			middleware = closure.Routers[closure.currentRouterIndex].middleware[closure.currentMiddlewareIndex]
+			middleware = closure.currentMiddleware()[closure.currentMiddlewareIndex]
 		} else {
 			// We ran out of middleware on the current router
-			if closure.currentRouterIndex == 0 {
+			if closure.currentRouterIndex == 0 && !closure.routed {
 				// If we're still on the root router, it's time to actually figure out what the route is.
 				// Do so, and update the various variables.
 				// We could also 404 at this point: if so, run NotFound handlers and return.
 				theRoute, wildcardMap := calculateRoute(closure.RootRouter, req)
 				if theRoute == nil && httpMethod(req.Method) == httpMethodOptions {
-					optionsMethod := req.Header.Get("Access-Control-Request-Method")
-					methods := make([]string, 0, len(httpMethods))
-					var lastLeaf *pathLeaf
-					for _, method := range httpMethods {
-						if method == httpMethodOptions {
-							continue
-						}
-						tree := closure.RootRouter.root[method]
-						leaf, wildcards := tree.Match(req.URL.Path)
-						if leaf != nil {
-							methods = append(methods, string(method))
-							lastLeaf = leaf
-							if optionsMethod == string(method) {
-								wildcardMap = wildcards
-							}
-						}
-					}
-
-					if len(methods) > 0 {
-						handler := &actionHandler{Generic: true, GenericHandler: closure.RootRouter.genericOptionsHandler(closure.Contexts[0], methods)}
-						theRoute = &route{Method: httpMethodOptions, Path: lastLeaf.route.Path, Router: lastLeaf.route.Router, Handler: handler}
-					}
+					theRoute, wildcardMap = closure.RootRouter.optionsRoute(req)
 				}
 
-				if theRoute == nil {
-					if closure.RootRouter.notFoundHandler.IsValid() {
-						invoke(closure.RootRouter.notFoundHandler, closure.Contexts[0], []reflect.Value{reflect.ValueOf(rw), reflect.ValueOf(req)})
+				matched := theRoute != nil
+				if !matched {
+					closure.RootRouter.observeNotFound(req)
+					// Route to the NotFound handler, as if it were a route of the router it was set on.
+					namespace := closure.RootRouter.routerForPath(req.URL.Path)
+					if target := namespace.notFoundRouter(); target != nil {
+						theRoute = &route{Method: httpMethod(req.Method), Router: target, Handler: target.notFoundHandler}
 					} else {
-						rw.WriteHeader(http.StatusNotFound)
-						fmt.Fprintf(rw, DefaultNotFoundResponse)
+						if namespace.rendersProblems() {
+							if methods := closure.RootRouter.allowedMethods(req.URL.Path); len(methods) > 0 {
+								writeError(rw, req, MethodNotAllowed("", methods...), true)
+							} else {
+								writeError(rw, req, NotFound(""), true)
+							}
+						} else {
+							rw.WriteHeader(http.StatusNotFound)
+							fmt.Fprintf(rw, DefaultNotFoundResponse)
+						}
+						return
 					}
-					return
 				}
 
 				closure.Routers = routersFor(theRoute, closure.Routers)
-				closure.Contexts = contextsFor(closure.Contexts, closure.Routers)
+				closure.Contexts = contextsFor(closure.Contexts, closure.Routers, req)
 
 				req.targetContext = closure.Contexts[len(closure.Contexts)-1]
+				req.contexts = closure.Contexts
 				req.route = theRoute
+				req.notFound = !matched
 				req.PathParams = wildcardMap
-			}
+				if matched {
+					closure.RootRouter.observeRouteMatched(req, theRoute)
+				}
 
-			closure.currentMiddlewareIndex = 0
-			closure.currentRouterIndex++
-			routersLen := len(closure.Routers)
-			for closure.currentRouterIndex < routersLen {
-				closure.currentMiddlewareLen = len(closure.Routers[closure.currentRouterIndex].middleware)
+				// The root router's routed middleware runs next, still on the root router.
+				closure.routed = true
+				closure.currentMiddlewareIndex = 0
+				closure.currentMiddlewareLen = len(closure.RootRouter.routedMiddleware)
 				if closure.currentMiddlewareLen > 0 {
-					break
+					middleware = closure.RootRouter.routedMiddleware[0]
 				}
-				closure.currentRouterIndex++
 			}
 
-			if closure.currentRouterIndex < routersLen {
-				middleware = closure.Routers[closure.currentRouterIndex].middleware[closure.currentMiddlewareIndex]
-			} else {
-				// Done! invoke the action.
-				handler := req.route.Handler
-				if handler.Generic {
-					handler.GenericHandler(rw, req)
+			if middleware == nil {
+				closure.currentMiddlewareIndex = 0
+				closure.currentRouterIndex++
+				routersLen := len(closure.Routers)
+				for closure.currentRouterIndex < routersLen {
+					closure.currentMiddlewareLen = len(closure.Routers[closure.currentRouterIndex].middleware)
+					if closure.currentMiddlewareLen > 0 {
+						break
+					}
+					closure.currentRouterIndex++
+				}
+
+				if closure.currentRouterIndex < routersLen {
+					middleware = closure.Routers[closure.currentRouterIndex].middleware[closure.currentMiddlewareIndex]
 				} else {
-					handler.DynamicHandler.Call([]reflect.Value{closure.Contexts[len(closure.Contexts)-1], reflect.ValueOf(rw), reflect.ValueOf(req)})
+					// Done! invoke the action.
+					if err := closure.invokeHandler(req.route.Handler, closure.Contexts[len(closure.Contexts)-1], rw, req); err != nil {
+						closure.handleReturnedError(rw, req, len(closure.Routers)-1, err)
+					}
 				}
 			}
 		}
@@ -276,9 +437,23 @@ func middlewareStack(closure *middlewareClosure) NextMiddlewareFunc {
 		closure.currentMiddlewareIndex++
 
 		// Invoke middleware.
+		// currentRouterIndex moves on as next is called, so remember which router the middleware belongs to.
 		if middleware != nil {
-			middleware.invoke(closure.Contexts[closure.currentRouterIndex], rw, req, closure.Next)
+			routerIndex := closure.currentRouterIndex
+			if err := closure.invokeMiddleware(middleware, closure.Contexts[routerIndex], rw, req); err != nil {
+				closure.handleReturnedError(rw, req, routerIndex, err)
+			}
+		}
+	}
+	return closure.step
+}
+
+// nextFor returns the Next function of the request with the closure's current generation.
+func (closure *middlewareClosure) nextFor(generation uint64) NextMiddlewareFunc {
+	return func(rw ResponseWriter, req *Request) {
+		if closure.generation.Load() != generation {
+			return
 		}
+		closure.step(rw, req)
 	}
-	return closure.Next
 }
@@ -3,6 +3,7 @@ package grom
 import (
 	"reflect"
 	"strings"
+	"sync"
 )
 
 const (
@@ -37,9 +38,13 @@ type GenericHandler func(ResponseWriter, *Request)
 type GenericMiddleware func(ResponseWriter, *Request, NextMiddlewareFunc)
 
 type actionHandler struct {
+	Name           string // The name of the handler function, for diagnostics.
 	Generic        bool
 	DynamicHandler reflect.Value
 	GenericHandler GenericHandler
+	// Calls the handler with a context without reflection.
+	// Set for typed handlers and specialized from DynamicHandler otherwise.
+	ContextHandler contextHandlerFunc
 }
 
 type route struct {
@@ -50,9 +55,13 @@ type route struct {
 }
 
 type middlewareHandler struct {
+	Name              string // The name of the middleware function, for diagnostics.
 	Generic           bool
 	DynamicMiddleware reflect.Value
 	GenericMiddleware GenericMiddleware
+	// Calls the middleware with a context without reflection.
+	// Set for typed middleware and specialized from DynamicMiddleware otherwise.
+	ContextMiddleware contextMiddlewareFunc
 }
 
 // Router implements net/http's Handler interface and is what you attach middleware, routes/handlers, and subrouters to.
@@ -63,21 +72,53 @@ type Router struct {
 	maxChildrenDepth int
 	// For each request we'll create one of these objects
 	contextType reflect.Type
+	// Index of the field in contextType that points to the parent context,
+	// and how many routers up the router that owns the parent context is.
+	// parentField is -1 for the root router and for routers that share their parent's context.
+	parentField int
+	parentDepth int
+	// Hooks that contextType declares (see context.go).
+	contextHooks contextHooks
+	// Reused contexts, if *contextType has a Reset method. nil otherwise.
+	contextPool *sync.Pool
+	// Builds the context for each request, if set with ContextFactory.
+	contextFactory func(parent reflect.Value, req *Request) reflect.Value
+	// Services registered with Provide, and the fields of new contexts they're assigned to.
+	services   []reflect.Value
+	injections []injection
+	// Reused per-request state. Only used on the root router.
+	closurePool sync.Pool
 	// e.g. "/" or "/admin".
 	// Any routes added to this router will be prefixed with this.
 	pathPrefix string
 	// Routeset contents:
 	middleware []*middlewareHandler
-	routes     []*route
+	// Root middleware that runs once the route has been calculated (see RoutedMiddleware).
+	routedMiddleware []*middlewareHandler
+	routes           []*route
 	// The root pathnode is the same for a tree of Routers
 	root map[httpMethod]*pathNode
 	// This can can be set on any router.
 	// The target's ErrorHandler will be invoked if it exists.
 	errorHandler reflect.Value
-	// This can only be set on the root handler, since by virtue of not finding a route, we don't have a target.
-	// (That being said, in the future we could investigate namespace matches)
-	notFoundHandler reflect.Value
-	// This can only be set on the root handler, since by virtue of not finding a route, we don't have a target.
+	// How default error responses are rendered (see ProblemDetails).
+	errorFormat errorFormat
+	// Where panics are reported, if not to the parent's reporter (see PanicHandler).
+	panicReporter PanicReporter
+	// Where mistakes are reported if strict mode is enabled (see StrictMode). Only used on the root router.
+	misuseReporter MisuseReporter
+	// Set if the profiler is enabled (see Profiler). Only used on the root router.
+	profilerOption *ProfilerOption
+	// Notified of the lifecycle of each request (see Observe). Only used on the root router.
+	observers []Observer
+	// Whether Request.Request carries the grom Request in its context (see StoreRequestInContext). Only used on the root router.
+	requestInContext bool
+	// This can be set on any router.
+	// When no route matches, the NotFound handler of the deepest router whose path prefix matches is invoked,
+	// or of its nearest parent that has one.
+	notFoundHandler *actionHandler
+	// This can be set on any router.
+	// The OptionsHandler of the matched route's router, or of its nearest parent that has one, is invoked.
 	optionsHandler reflect.Value
 }
 
@@ -88,8 +129,8 @@ type Router struct {
 // an instance of this context type will be automatically allocated and sent to handlers.
 func New(ctx interface{}) *Router {
 	validateContext(ctx, nil)
-	r := &Router{}
-	r.contextType = reflect.TypeOf(ctx)
+	r := &Router{parentField: -1}
+	r.setContextType(reflect.TypeOf(ctx))
 	r.pathPrefix = "/"
 	r.maxChildrenDepth = 1
 	r.root = make(map[httpMethod]*pathNode)
@@ -110,14 +151,17 @@ func NewWithPrefix(ctx interface{}, pathPrefix string) *Router {
 
 // Subrouter attaches a new subrouter to the specified router and returns it.
 // You can use the same context or pass a new one.
-// If you pass a new one, it must
-// embed a pointer to the previous context in the first slot.
+// If you pass a new one, it must have a field that points to the previous context,
+// or to the context of any router further up.
+// A field tagged `grom:"parent"` is used if there is one.
+// Otherwise, the first field that points to the nearest ancestor's context is used.
 // You can also pass a pathPrefix that each route will have.
 // If "" is passed, then no path prefix is applied.
 func (r *Router) Subrouter(ctx interface{}, pathPrefix string) *Router {
-	validateContext(ctx, r.contextType)
+	validateContext(ctx, r)
 	// Create new router, link up hierarchy
 	newRouter := &Router{parent: r}
+	newRouter.parentField, newRouter.parentDepth = parentFieldFor(reflect.TypeOf(ctx), r)
 	r.children = append(r.children, newRouter)
 	// Increment maxChildrenDepth if this is the first child of the router
 	if len(r.children) == 1 {
@@ -128,21 +172,44 @@ func (r *Router) Subrouter(ctx interface{}, pathPrefix string) *Router {
 		}
 	}
 
-	newRouter.contextType = reflect.TypeOf(ctx)
+	newRouter.setContextType(reflect.TypeOf(ctx))
+	newRouter.updateInjections()
 	newRouter.pathPrefix = appendPath(r.pathPrefix, pathPrefix)
 	newRouter.root = r.root
 	return newRouter
 }
 
 // Middleware adds the specified middleware tot he router and returns the router.
+// fn can also be middleware returned by When, or a Chain.
 func (r *Router) Middleware(fn interface{}) *Router {
-	vfn := reflect.ValueOf(fn)
-	validateMiddleware(vfn, r.contextType)
-	if vfn.Type().NumIn() == 3 {
-		r.middleware = append(r.middleware, &middlewareHandler{Generic: true, GenericMiddleware: fn.(func(ResponseWriter, *Request, NextMiddlewareFunc))})
-	} else {
-		r.middleware = append(r.middleware, &middlewareHandler{Generic: false, DynamicMiddleware: vfn})
+	r.middleware = append(r.middleware, middlewareHandlersFor(fn, r.contextType)...)
+	return r
+}
+
+// RoutedMiddleware adds middleware that runs once the request has been routed and returns the router.
+// Unlike middleware added with Middleware, it can use RoutePath and PathParams,
+// e.g. for authorization by route or for metrics labeled by route.
+// It runs after all other root middleware and before the middleware of subrouters, with the root context.
+// It also runs before a NotFound handler, with IsRouted false and an empty RoutePath.
+// It can only be added to the root router, since middleware of subrouters always runs after routing.
+func (r *Router) RoutedMiddleware(fn interface{}) *Router {
+	if r.parent != nil {
+		panic("You can only add RoutedMiddleware to the root router.")
 	}
+	r.routedMiddleware = append(r.routedMiddleware, middlewareHandlersFor(fn, r.contextType)...)
+	return r
+}
+
+// ContextFactory sets the function that builds this router's context on each request and returns the router.
+// On the root router, fn looks like func(req *Request) *YourContext.
+// On a subrouter, fn is also passed the parent context: func(parent *ParentContext, req *Request) *YourContext.
+// grom sets the parent pointer of the returned context itself.
+// Contexts built by a factory are never reused, even if they have a Reset method.
+func (r *Router) ContextFactory(fn interface{}) *Router {
+	vfn := reflect.ValueOf(fn)
+	validateContextFactory(vfn, r)
+	r.contextFactory = contextFactoryFor(vfn, r.contextType)
+	r.contextPool = nil
 	return r
 }
 
@@ -155,23 +222,21 @@ func (r *Router) Error(fn interface{}) *Router {
 }
 
 // NotFound sets the specified function as the not-found handler (when no route matches) and returns the router.
-// Note that only the root router can have a NotFound handler.
+// It is invoked for requests whose path falls under the router's path prefix, unless a subrouter with a
+// longer matching prefix has a NotFound handler of its own. It gets the router's context, and the middleware
+// of the router and its parents runs before it, as it would for a route.
 func (r *Router) NotFound(fn interface{}) *Router {
-	if r.parent != nil {
-		panic("You can only set a NotFoundHandler on the root router.")
-	}
 	vfn := reflect.ValueOf(fn)
 	validateNotFoundHandler(vfn, r.contextType)
-	r.notFoundHandler = vfn
+	r.notFoundHandler = actionHandlerFor(vfn)
 	return r
 }
 
 // OptionsHandler sets the specified function as the options handler and returns the router.
-// Note that only the root router can have a OptionsHandler handler.
+// It answers OPTIONS requests for the routes of the router and its subrouters that have no OPTIONS route,
+// unless a subrouter closer to the route has an OptionsHandler of its own.
+// It is passed the router's context and the methods that have a route for the path.
 func (r *Router) OptionsHandler(fn interface{}) *Router {
-	if r.parent != nil {
-		panic("You can only set an OptionsHandler on the root router.")
-	}
 	vfn := reflect.ValueOf(fn)
 	validateOptionsHandler(vfn, r.contextType)
 	r.optionsHandler = vfn
@@ -228,13 +293,12 @@ func (r *Router) depth() (max int) {
 func (r *Router) addRoute(method httpMethod, path string, fn interface{}) *Router {
 	vfn := reflect.ValueOf(fn)
 	validateHandler(vfn, r.contextType)
+	return r.addActionHandler(method, path, actionHandlerFor(vfn))
+}
+
+func (r *Router) addActionHandler(method httpMethod, path string, handler *actionHandler) *Router {
 	fullPath := appendPath(r.pathPrefix, path)
-	route := &route{Method: method, Path: fullPath, Router: r}
-	if vfn.Type().NumIn() == 2 {
-		route.Handler = &actionHandler{Generic: true, GenericHandler: fn.(func(ResponseWriter, *Request))}
-	} else {
-		route.Handler = &actionHandler{Generic: false, DynamicHandler: vfn}
-	}
+	route := &route{Method: method, Path: fullPath, Router: r, Handler: handler}
 	r.routes = append(r.routes, route)
 	r.root[method].add(fullPath, route)
 	return r
@@ -242,9 +306,9 @@ func (r *Router) addRoute(method httpMethod, path string, fn interface{}) *Route
 
 // Ensures vfn is a function, that optionally takes a *ctxType as the first argument,
 // followed by the specified types.
-// Handlers have no return value.
+// Handlers have no return value, unless mayReturnError is true, in which case they can return an error.
 // Returns true if valid, false otherwise.
-func isValidHandler(vfn reflect.Value, ctxType reflect.Type, types ...reflect.Type) bool {
+func isValidHandler(vfn reflect.Value, ctxType reflect.Type, mayReturnError bool, types ...reflect.Type) bool {
 	fnType := vfn.Type()
 	if fnType.Kind() != reflect.Func {
 		return false
@@ -254,7 +318,7 @@ func isValidHandler(vfn reflect.Value, ctxType reflect.Type, types ...reflect.Ty
 	typesLen := len(types)
 	numIn := fnType.NumIn()
 	numOut := fnType.NumOut()
-	if numOut != 0 {
+	if numOut > 1 || (numOut == 1 && (!mayReturnError || fnType.Out(0) != errorType)) {
 		return false
 	}
 
@@ -318,23 +382,87 @@ func instructiveMessage(vfn reflect.Value, addingType string, yourType string, a
 }
 
 // Panics unless validation is correct
-func validateContext(ctx interface{}, parentCtxType reflect.Type) {
+func validateContext(ctx interface{}, parent *Router) {
 	ctxType := reflect.TypeOf(ctx)
 	if ctxType.Kind() != reflect.Struct {
 		panic("web: Context needs to be a struct type")
 	}
 
-	if parentCtxType != nil && parentCtxType != ctxType {
-		if ctxType.NumField() == 0 {
-			panic("web: Context needs to have first field be a pointer to parent context")
+	if parent != nil {
+		parentFieldFor(ctxType, parent)
+	}
+}
+
+// parentFieldFor returns the index of the field in ctxType that points to a parent context,
+// and the distance from a subrouter of parent to the router that owns that context.
+// Returns -1 if ctxType is parent's context type, in which case the context is shared.
+// Panics if there's no such field.
+func parentFieldFor(ctxType reflect.Type, parent *Router) (field int, depth int) {
+	if parent.contextType == ctxType {
+		return -1, 0
+	}
+
+	for i := 0; i < ctxType.NumField(); i++ {
+		if fld := ctxType.Field(i); fld.Tag.Get("grom") == "parent" {
+			if depth = ancestorDepth(parent, fld.Type); depth == 0 {
+				panic("web: Context field " + fld.Name + " is tagged as the parent but isn't a pointer to a parent context")
+			}
+			return validateParentField(fld, i), depth
 		}
+	}
 
-		fldType := ctxType.Field(0).Type
-		// Ensure fld is a pointer to parentCtxType
-		if fldType != reflect.PtrTo(parentCtxType) {
-			panic("web: Context needs to have first field be a pointer to parent context")
+	for depth, ancestor := 1, parent; ancestor != nil; depth, ancestor = depth+1, ancestor.parent {
+		for i := 0; i < ctxType.NumField(); i++ {
+			if fld := ctxType.Field(i); fld.Type == reflect.PtrTo(ancestor.contextType) {
+				return validateParentField(fld, i), depth
+			}
 		}
 	}
+	panic("web: Context needs to have a field that is a pointer to a parent context")
+}
+
+// ancestorDepth returns how many routers up from a subrouter of parent
+// the nearest router with context type *ptrType is, or 0 if there's none.
+func ancestorDepth(parent *Router, ptrType reflect.Type) int {
+	for depth, ancestor := 1, parent; ancestor != nil; depth, ancestor = depth+1, ancestor.parent {
+		if ptrType == reflect.PtrTo(ancestor.contextType) {
+			return depth
+		}
+	}
+	return 0
+}
+
+func validateParentField(fld reflect.StructField, i int) int {
+	if fld.PkgPath != "" {
+		panic("web: Context field " + fld.Name + " points to the parent context, so it needs to be exported")
+	}
+	return i
+}
+
+// Panics unless fn builds a context for r, given the parent context (unless r is the root router) and the request.
+func validateContextFactory(vfn reflect.Value, r *Router) {
+	var req *Request
+	ctxString := reflect.PtrTo(r.contextType).String()
+	args := []reflect.Type{reflect.TypeOf(req)}
+	signature := "func(req *web.Request) " + ctxString
+	if r.parent != nil {
+		if r.parentField < 0 {
+			panic("web: a router that shares its parent's context can't have a ContextFactory")
+		}
+		parentType := r.contextType.Field(r.parentField).Type
+		args = append([]reflect.Type{parentType}, args...)
+		signature = "func(parent " + parentType.String() + ", req *web.Request) " + ctxString
+	}
+
+	fnType := vfn.Type()
+	valid := fnType.Kind() == reflect.Func && fnType.NumIn() == len(args) && fnType.NumOut() == 1 && fnType.Out(0) == reflect.PtrTo(r.contextType)
+	for i := 0; valid && i < len(args); i++ {
+		valid = fnType.In(i) == args[i]
+	}
+
+	if !valid {
+		panic("web: ContextFactory needs a function with the signature " + signature + ", but got " + fnType.String())
+	}
 }
 
 // Panics unless fn is a proper handler wrt ctxType
@@ -342,7 +470,7 @@ func validateContext(ctx interface{}, parentCtxType reflect.Type) {
 func validateHandler(vfn reflect.Value, ctxType reflect.Type) {
 	var req *Request
 	var resp func() ResponseWriter
-	if !isValidHandler(vfn, ctxType, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req)) {
+	if !isValidHandler(vfn, ctxType, true, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req)) {
 		panic(instructiveMessage(vfn, "a handler", "handler", "rw web.ResponseWriter, req *web.Request", ctxType))
 	}
 }
@@ -350,7 +478,7 @@ func validateHandler(vfn reflect.Value, ctxType reflect.Type) {
 func validateErrorHandler(vfn reflect.Value, ctxType reflect.Type) {
 	var req *Request
 	var resp func() ResponseWriter
-	if !isValidHandler(vfn, ctxType, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req), emptyInterfaceType) {
+	if !isValidHandler(vfn, ctxType, true, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req), emptyInterfaceType) {
 		panic(instructiveMessage(vfn, "an error handler", "error handler", "rw web.ResponseWriter, req *web.Request, err interface{}", ctxType))
 	}
 }
@@ -358,7 +486,7 @@ func validateErrorHandler(vfn reflect.Value, ctxType reflect.Type) {
 func validateNotFoundHandler(vfn reflect.Value, ctxType reflect.Type) {
 	var req *Request
 	var resp func() ResponseWriter
-	if !isValidHandler(vfn, ctxType, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req)) {
+	if !isValidHandler(vfn, ctxType, false, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req)) {
 		panic(instructiveMessage(vfn, "a 'not found' handler", "not found handler", "rw web.ResponseWriter, req *web.Request", ctxType))
 	}
 }
@@ -367,7 +495,7 @@ func validateOptionsHandler(vfn reflect.Value, ctxType reflect.Type) {
 	var req *Request
 	var resp func() ResponseWriter
 	var methods []string
-	if !isValidHandler(vfn, ctxType, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req), reflect.TypeOf(methods)) {
+	if !isValidHandler(vfn, ctxType, false, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req), reflect.TypeOf(methods)) {
 		panic(instructiveMessage(vfn, "an 'options' handler", "options handler", "rw web.ResponseWriter, req *web.Request, methods []string", ctxType))
 	}
 }
@@ -376,7 +504,7 @@ func validateMiddleware(vfn reflect.Value, ctxType reflect.Type) {
 	var req *Request
 	var resp func() ResponseWriter
 	var n NextMiddlewareFunc
-	if !isValidHandler(vfn, ctxType, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req), reflect.TypeOf(n)) {
+	if !isValidHandler(vfn, ctxType, true, reflect.TypeOf(resp).Out(0), reflect.TypeOf(req), reflect.TypeOf(n)) {
 		panic(instructiveMessage(vfn, "middleware", "middleware", "rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc", ctxType))
 	}
 }
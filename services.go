@@ -0,0 +1,78 @@
+package grom
+
+import "reflect"
+
+// injection assigns a provided service to a field of a new context.
+type injection struct {
+	field int
+	value reflect.Value
+}
+
+// Provide registers a long-lived dependency, such as a database handle or a cache, and returns the router.
+// Each new context of this router and of its subrouters gets service assigned to its exported fields
+// of exactly the type of service, unless the field has already been set (e.g., by a ContextFactory).
+// Fields of an interface type that service implements only get it if they're tagged `grom:"inject"`,
+// so that e.g. a *sql.DB doesn't end up in every io.Closer or interface{} field.
+// If several services match a field, the one provided last on the nearest router wins.
+// A router that shares its parent's context doesn't build one, so services have to be provided on
+// the router whose context it shares instead.
+func (r *Router) Provide(service interface{}) *Router {
+	if service == nil {
+		panic("web: can't Provide a nil service")
+	}
+	if r.parent != nil && r.parentField < 0 {
+		panic("web: a router that shares its parent's context can't Provide services")
+	}
+	r.services = append(r.services, reflect.ValueOf(service))
+	r.updateInjections()
+	return r
+}
+
+// updateInjections recalculates which services are injected into the contexts of r and of its subrouters.
+func (r *Router) updateInjections() {
+	r.injections = nil
+	// Routers that share their parent's context don't allocate one.
+	if r.parentField >= 0 || r.parent == nil {
+		for i := 0; i < r.contextType.NumField(); i++ {
+			fld := r.contextType.Field(i)
+			if i == r.parentField || fld.PkgPath != "" {
+				continue
+			}
+			if service, ok := r.serviceFor(fld); ok {
+				r.injections = append(r.injections, injection{field: i, value: service})
+			}
+		}
+	}
+
+	for _, child := range r.children {
+		child.updateInjections()
+	}
+}
+
+// serviceFor returns the service provided on r or on its ancestors that is injected into the field fld.
+func (r *Router) serviceFor(fld reflect.StructField) (reflect.Value, bool) {
+	optedIn := fld.Type.Kind() == reflect.Interface && fld.Tag.Get("grom") == "inject"
+	for cur := r; cur != nil; cur = cur.parent {
+		for i := len(cur.services) - 1; i >= 0; i-- {
+			serviceType := cur.services[i].Type()
+			if serviceType == fld.Type || optedIn && serviceType.Implements(fld.Type) {
+				return cur.services[i], true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// injectServices assigns the router's services to the context ctx.
+func (r *Router) injectServices(ctx reflect.Value) {
+	if len(r.injections) == 0 {
+		return
+	}
+
+	ctxStruct := reflect.Indirect(ctx)
+	for _, inj := range r.injections {
+		if fld := ctxStruct.Field(inj.field); fld.IsZero() {
+			fld.Set(inj.value)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDB struct {
+	name string
+}
+
+type testCache interface {
+	Get(key string) string
+}
+
+type mapCache map[string]string
+
+func (c mapCache) Get(key string) string {
+	return c[key]
+}
+
+type ServiceContext struct {
+	DB    *testDB
+	Cache testCache `grom:"inject"`
+}
+
+type ServiceAdminContext struct {
+	*ServiceContext
+	DB    *testDB
+	Cache testCache `grom:"inject"`
+}
+
+func TestProvide(t *testing.T) {
+	router := New(ServiceContext{})
+	router.Get("/action", func(c *ServiceContext, rw ResponseWriter, req *Request) {
+		fmt.Fprintf(rw, "%s %s", c.DB.name, c.Cache.Get("key"))
+	})
+
+	// Subrouters created before and after Provide both get services.
+	admin := router.Subrouter(ServiceAdminContext{}, "/admin")
+	router.Provide(&testDB{name: "main"})
+	router.Provide(mapCache{"key": "cached"})
+	admin.Provide(&testDB{name: "admin"})
+	admin.Get("/action", func(c *ServiceAdminContext, rw ResponseWriter, req *Request) {
+		fmt.Fprintf(rw, "%s %s %s", c.DB.name, c.ServiceContext.DB.name, c.Cache.Get("key"))
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "main cached", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "admin main cached", http.StatusOK)
+}
+
+func TestProvideKeepsFactoryFields(t *testing.T) {
+	router := New(ServiceContext{})
+	router.Provide(&testDB{name: "provided"})
+	router.ContextFactory(func(req *Request) *ServiceContext {
+		return &ServiceContext{DB: &testDB{name: "factory"}}
+	})
+	router.Get("/action", func(c *ServiceContext, rw ResponseWriter, req *Request) {
+		fmt.Fprint(rw, c.DB.name)
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "factory", http.StatusOK)
+}
+
+type UntaggedServiceContext struct {
+	DB    *testDB
+	Data  interface{}
+	Cache testCache
+	Name  fmt.Stringer
+}
+
+func (db *testDB) String() string {
+	return db.name
+}
+
+func TestProvideMatchesExactType(t *testing.T) {
+	var ctx *UntaggedServiceContext
+	router := New(UntaggedServiceContext{})
+	router.Provide(&testDB{name: "main"})
+	router.Provide(mapCache{"key": "cached"})
+	router.Get("/action", func(c *UntaggedServiceContext, rw ResponseWriter, req *Request) {
+		ctx = c
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, "main", ctx.DB.name)
+	assert.Nil(t, ctx.Data)
+	assert.Nil(t, ctx.Cache)
+	assert.Nil(t, ctx.Name)
+}
+
+func TestProvideNil(t *testing.T) {
+	router := New(ServiceContext{})
+	assert.Panics(t, func() {
+		router.Provide(nil)
+	})
+}
+
+func TestProvideOnSharedContextRouter(t *testing.T) {
+	router := New(ServiceContext{})
+	api := router.Subrouter(ServiceContext{}, "/api")
+	assert.Panics(t, func() {
+		api.Provide(&testDB{name: "api"})
+	})
+}
@@ -128,10 +128,7 @@ const panicPageTpl string = `
 func ShowErrorsMiddleware(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
 	defer func() {
 		if err := recover(); err != nil {
-			const size = 4096
-			stack := make([]byte, size)
-			stack = stack[:runtime.Stack(stack, false)]
-			renderPrettyError(rw, req, err, stack)
+			renderPrettyError(rw, req, err, []byte(fullStack()))
 		}
 	}()
 	next(rw, req)
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -87,6 +88,21 @@ func BenchmarkGrom_Simple(b *testing.B) {
 
 	rw, req := testRequest("GET", "/action")
 
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(rw, req)
+	}
+}
+
+// The cost of StoreRequestInContext, compared to BenchmarkGrom_Simple.
+func BenchmarkGrom_RequestInContext(b *testing.B) {
+	router := New(BenchContext{}).StoreRequestInContext(true)
+	router.Get("/action", gromHandler)
+
+	rw, req := testRequest("GET", "/action")
+
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		router.ServeHTTP(rw, req)
@@ -159,6 +175,75 @@ func BenchmarkGrom_Generic(b *testing.B) {
 	}
 }
 
+// Same tree as BenchmarkGrom_Middleware, with handlers and middleware
+// dispatched through a typed router.
+func BenchmarkGrom_Typed(b *testing.B) {
+	router := NewTyped[BenchContext]()
+	router.Middleware((*BenchContext).Middleware)
+	router.Middleware((*BenchContext).Middleware)
+	routerB := Subrouter[BenchContext, BenchContextB](router, "/b")
+	routerB.Middleware((*BenchContextB).Middleware)
+	routerB.Middleware((*BenchContextB).Middleware)
+	routerC := Subrouter[BenchContextB, BenchContextC](routerB, "/c")
+	routerC.Middleware((*BenchContextC).Middleware)
+	routerC.Middleware((*BenchContextC).Middleware)
+	routerC.Get("/action", (*BenchContextC).Action)
+
+	rw, req := testRequest("GET", "/b/c/action")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(rw, req)
+	}
+}
+
+// Middleware and handlers that accept the context as an interface{}.
+func BenchmarkGrom_InterfaceContext(b *testing.B) {
+	mw := func(c interface{}, rw ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		next(rw, r)
+	}
+
+	router := New(BenchContext{})
+	router.Middleware(mw)
+	router.Middleware(mw)
+	router.Get("/action", func(c interface{}, rw ResponseWriter, r *Request) {
+		fmt.Fprintf(rw, "hello")
+	})
+
+	rw, req := testRequest("GET", "/action")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(rw, req)
+	}
+}
+
+// Dispatch of a single context handler, without routing.
+func BenchmarkGrom_ContextDispatch(b *testing.B) {
+	handler := contextHandlerFor(reflect.ValueOf((*BenchContext).Action))
+	ctx := reflect.New(reflect.TypeOf(BenchContext{}))
+	rw := &appResponseWriter{ResponseWriter: &NullWriter{}}
+	req := &Request{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(ctx, rw, req)
+	}
+}
+
+// Dispatch of a single context handler through reflect.Value.Call, for comparison.
+func BenchmarkGrom_ReflectDispatch(b *testing.B) {
+	handler := reflect.ValueOf((*BenchContext).Action)
+	ctx := reflect.New(reflect.TypeOf(BenchContext{}))
+	rw := &appResponseWriter{ResponseWriter: &NullWriter{}}
+	req := &Request{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.Call([]reflect.Value{ctx, reflect.ValueOf(rw), reflect.ValueOf(req)})
+	}
+}
+
 // Intended to be my "single metric". It does a bit of everything.
 // 75 routes, middleware, and middleware -> handler communication.
 func BenchmarkGrom_Composite(b *testing.B) {
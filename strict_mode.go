@@ -0,0 +1,196 @@
+package grom
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// MisuseKind is a kind of mistake detected in strict mode (see StrictMode).
+type MisuseKind string
+
+const (
+	// NextCalledTwice is reported when middleware calls next more than once.
+	// The second call is ignored, since it would skip the rest of the middleware.
+	NextCalledTwice MisuseKind = "next called twice"
+	// NextAfterWrite is reported when middleware calls next after the response was written.
+	NextAfterWrite MisuseKind = "next called after the response was written"
+	// WriteHeaderTwice is reported when WriteHeader is called after the header was written.
+	WriteHeaderTwice MisuseKind = "WriteHeader called after the header was written"
+	// WriteAfterHijack is reported when the ResponseWriter is written to after its connection was hijacked.
+	WriteAfterHijack MisuseKind = "ResponseWriter written to after Hijack"
+	// ResponseWriterRetained is reported when the ResponseWriter is used after the request was served.
+	ResponseWriterRetained MisuseKind = "ResponseWriter used after the request was served"
+)
+
+// Misuse describes a mistake in the use of middleware or of the ResponseWriter detected in strict mode.
+type Misuse struct {
+	Kind       MisuseKind
+	Middleware string // The middleware or handler that was running, e.g. "main.(*Context).Auth", or "" if none was.
+	CallSite   string // The file and line of the offending call.
+	Method     string
+	URL        string
+	RoutePath  string // The pattern of the route, or "" if the request wasn't routed.
+}
+
+func (m *Misuse) String() string {
+	middleware := m.Middleware
+	if middleware == "" {
+		middleware = "unknown middleware"
+	}
+	return fmt.Sprintf("%s in %s at %s (%s %s)", m.Kind, middleware, m.CallSite, m.Method, m.URL)
+}
+
+// MisuseReporter receives the mistakes detected in strict mode.
+type MisuseReporter interface {
+	ReportMisuse(misuse *Misuse)
+}
+
+// MisuseReporterFunc is a function that implements MisuseReporter.
+type MisuseReporterFunc func(misuse *Misuse)
+
+// ReportMisuse calls f(misuse).
+func (f MisuseReporterFunc) ReportMisuse(misuse *Misuse) {
+	f(misuse)
+}
+
+var defaultMisuseReporter = logMisuseReporter{
+	log: log.New(os.Stderr, "WARN ", log.Ldate|log.Ltime|log.Lmicroseconds),
+}
+
+type logMisuseReporter struct {
+	log *log.Logger
+}
+
+func (l logMisuseReporter) ReportMisuse(misuse *Misuse) {
+	l.log.Printf("MISUSE %s\n", misuse)
+}
+
+// StrictMode enables strict mode and returns the router. Strict mode is meant for development:
+// it checks every request for common mistakes in middleware and handlers and reports them to reporter,
+// or logs them if reporter is nil. See MisuseKind for the mistakes that are detected.
+// It can only be enabled on the root router.
+func (r *Router) StrictMode(reporter MisuseReporter) *Router {
+	if r.parent != nil {
+		panic("You can only enable StrictMode on the root router.")
+	}
+	if reporter == nil {
+		reporter = defaultMisuseReporter
+	}
+	r.misuseReporter = reporter
+	return r
+}
+
+// diagnostics keeps track of a request in strict mode.
+type diagnostics struct {
+	reporter MisuseReporter
+	rw       *appResponseWriter
+	req      *Request
+	running  string      // The name of the middleware or handler that is running.
+	served   atomic.Bool // Set once ServeHTTP returns. The ResponseWriter may be retained by another goroutine.
+}
+
+func newDiagnostics(reporter MisuseReporter, state *requestState) *diagnostics {
+	return &diagnostics{reporter: reporter, rw: &state.appResponseWriter, req: &state.Request}
+}
+
+// invokeMiddleware invokes mw with a next function that reports being called twice or after the response was written.
+func (d *diagnostics) invokeMiddleware(mw *middlewareHandler, ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+	running := d.running
+	d.running = mw.Name
+	defer func() {
+		d.running = running
+	}()
+
+	called := false
+	return mw.invoke(ctx, rw, req, func(rw ResponseWriter, req *Request) {
+		if called {
+			d.report(NextCalledTwice)
+			return
+		}
+		called = true
+		if d.rw.Written() {
+			d.report(NextAfterWrite)
+		}
+		next(rw, req)
+	})
+}
+
+func (d *diagnostics) invokeHandler(h *actionHandler, ctx reflect.Value, rw ResponseWriter, req *Request) error {
+	running := d.running
+	d.running = h.Name
+	defer func() {
+		d.running = running
+	}()
+	return h.invoke(ctx, rw, req)
+}
+
+// checkUse reports using the ResponseWriter after the request was served.
+func (d *diagnostics) checkUse() bool {
+	if d.served.Load() {
+		d.report(ResponseWriterRetained)
+		return false
+	}
+	return true
+}
+
+// checkWrite reports writing after the request was served or the connection was hijacked.
+func (d *diagnostics) checkWrite() bool {
+	if !d.checkUse() {
+		return false
+	}
+	if d.rw.hijacked {
+		d.report(WriteAfterHijack)
+		return false
+	}
+	return true
+}
+
+// checkWriteHeader reports writing the header more than once. Informational (1xx) headers can precede the final one.
+func (d *diagnostics) checkWriteHeader() {
+	if d.checkWrite() && d.rw.statusCode >= 200 {
+		d.report(WriteHeaderTwice)
+	}
+}
+
+func (d *diagnostics) report(kind MisuseKind) {
+	d.reporter.ReportMisuse(&Misuse{
+		Kind:       kind,
+		Middleware: d.running,
+		CallSite:   callSite(),
+		Method:     d.req.Method,
+		URL:        fmt.Sprint(d.req.URL),
+		RoutePath:  d.req.RoutePath(),
+	})
+}
+
+// packageDir is the directory of this package's source files, which aren't call sites worth reporting.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// callSite returns the file and line of the innermost call in the stack made by the application,
+// skipping this package and the standard library packages that write to a ResponseWriter.
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		internal := filepath.Dir(frame.File) == packageDir && !strings.HasSuffix(frame.File, "_test.go")
+		for _, pkg := range []string{"runtime.", "reflect.", "fmt.", "io.", "bufio.", "net/http.", "encoding/json."} {
+			internal = internal || strings.HasPrefix(frame.Function, pkg)
+		}
+		if !internal {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package grom
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func strictRouter() (*Router, *[]*Misuse) {
+	var misuses []*Misuse
+	router := New(Context{}).StrictMode(MisuseReporterFunc(func(misuse *Misuse) {
+		misuses = append(misuses, misuse)
+	}))
+	return router, &misuses
+}
+
+func (c *Context) mwNextTwice(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+	next(w, r)
+	next(w, r)
+}
+
+func (c *Context) mwHeader(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+	w.Header().Add("X-Middleware", "header")
+	next(w, r)
+}
+
+func TestStrictModeNextCalledTwice(t *testing.T) {
+	router, misuses := strictRouter()
+	router.Middleware((*Context).mwNextTwice)
+	router.Middleware((*Context).mwHeader)
+	router.Get("/users/:id", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/users/3")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "context-A", 200)
+	assert.Equal(t, []string{"header"}, rw.Header().Values("X-Middleware"))
+
+	if assert.Len(t, *misuses, 1) {
+		misuse := (*misuses)[0]
+		assert.Equal(t, NextCalledTwice, misuse.Kind)
+		assert.Equal(t, "github.com/pchchv/grom.(*Context).mwNextTwice", misuse.Middleware)
+		assert.Contains(t, misuse.CallSite, "strict_mode_test.go:")
+		assert.Equal(t, "GET", misuse.Method)
+		assert.Equal(t, "/users/3", misuse.URL)
+		assert.Equal(t, "/users/:id", misuse.RoutePath)
+	}
+}
+
+func TestStrictModeNextAfterWrite(t *testing.T) {
+	router, misuses := strictRouter()
+	router.Middleware(func(w ResponseWriter, r *Request, next NextMiddlewareFunc) {
+		fmt.Fprint(w, "early ")
+		next(w, r)
+	})
+	router.Get("/action", (*Context).A)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "early context-A", 200)
+	if assert.Len(t, *misuses, 1) {
+		assert.Equal(t, NextAfterWrite, (*misuses)[0].Kind)
+		assert.Contains(t, (*misuses)[0].Middleware, "TestStrictModeNextAfterWrite")
+	}
+}
+
+func TestStrictModeWriteHeaderTwice(t *testing.T) {
+	router, misuses := strictRouter()
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusOK)
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	if assert.Len(t, *misuses, 1) {
+		misuse := (*misuses)[0]
+		assert.Equal(t, WriteHeaderTwice, misuse.Kind)
+		assert.Contains(t, misuse.Middleware, "TestStrictModeWriteHeaderTwice")
+		assert.Contains(t, misuse.CallSite, "strict_mode_test.go:")
+		assert.Contains(t, misuse.String(), "WriteHeader called after the header was written")
+	}
+}
+
+func TestStrictModeWriteAfterHijack(t *testing.T) {
+	router, misuses := strictRouter()
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		w.Hijack()
+		fmt.Fprint(w, "too late")
+	})
+
+	_, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(&hijackableResponse{}, req)
+	if assert.Len(t, *misuses, 1) {
+		assert.Equal(t, WriteAfterHijack, (*misuses)[0].Kind)
+	}
+}
+
+func TestStrictModeResponseWriterRetained(t *testing.T) {
+	var retained ResponseWriter
+	router, misuses := strictRouter()
+	router.Get("/action", func(w ResponseWriter, r *Request) {
+		retained = w
+	})
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assert.Len(t, *misuses, 0)
+
+	retained.Header().Set("X-Late", "1")
+	fmt.Fprint(retained, "late")
+	if assert.Len(t, *misuses, 2) {
+		assert.Equal(t, ResponseWriterRetained, (*misuses)[0].Kind)
+		assert.Equal(t, ResponseWriterRetained, (*misuses)[1].Kind)
+		assert.Contains(t, (*misuses)[1].CallSite, "strict_mode_test.go:")
+	}
+}
+
+func TestStrictModeQuiet(t *testing.T) {
+	router, misuses := strictRouter()
+	router.Middleware((*Context).mwHeader)
+	router.Middleware(LoggerMiddleware)
+	router.Get("/action", (*Context).A)
+	router.Get("/error", func(w ResponseWriter, r *Request) error {
+		return NotFound("no such thing")
+	})
+
+	for _, path := range []string{"/action", "/error", "/missing"} {
+		rw, req := newTestRequest("GET", path)
+		router.ServeHTTP(rw, req)
+	}
+	assert.Len(t, *misuses, 0)
+
+	assert.Panics(t, func() {
+		router.Subrouter(Context{}, "/sub").StrictMode(nil)
+	})
+}
+
+func TestMisuseString(t *testing.T) {
+	misuse := &Misuse{Kind: NextCalledTwice, CallSite: "main.go:12", Method: "GET", URL: "/"}
+	assert.True(t, strings.HasPrefix(misuse.String(), "next called twice in unknown middleware at main.go:12"))
+}
@@ -143,12 +143,12 @@ func (pn *pathNode) addInternal(segments []string, route *route, wildcards []str
 			}
 			pn.wildcard.addInternal(segments[1:], route, append(wildcards, wcName), append(regexps, compileRegexp(wcRegexpStr)))
 		} else {
-			if subPn, ok := pn.edges[seg]; !ok {
+			subPn, ok := pn.edges[seg]
+			if !ok {
 				subPn = newPathNode()
 				pn.edges[seg] = subPn
-			} else {
-				subPn.addInternal(segments[1:], route, wildcards, regexps)
 			}
+			subPn.addInternal(segments[1:], route, wildcards, regexps)
 		}
 	}
 }
@@ -201,6 +201,12 @@ func compileRegexp(regStr string) *regexp.Regexp {
 // "/admin" -> ["admin"]
 // "/admin/" -> ["admin"]
 // "/admin/users" -> ["admin", "users"]
+// cleanPath returns path as the tree matches it, with a single leading slash and no trailing slash,
+// e.g. "/login" for "/login/".
+func cleanPath(path string) string {
+	return "/" + strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/")
+}
+
 func splitPath(key string) []string {
 	elements := strings.Split(key, "/")
 	if elements[0] == "" {
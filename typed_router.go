@@ -0,0 +1,230 @@
+package grom
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypedHandler is a handler whose context type is checked at compile time.
+type TypedHandler[C any] func(*C, ResponseWriter, *Request)
+
+// TypedMiddleware is middleware whose context type is checked at compile time.
+type TypedMiddleware[C any] func(*C, ResponseWriter, *Request, NextMiddlewareFunc)
+
+// TypedErrorHandler is an error handler whose context type is checked at compile time.
+type TypedErrorHandler[C any] func(*C, ResponseWriter, *Request, interface{})
+
+// TypedHandlerE is a typed handler that returns an error, which is handled like a panic
+// by the Error handler of the router or of its nearest parent that has one.
+type TypedHandlerE[C any] func(*C, ResponseWriter, *Request) error
+
+// TypedMiddlewareE is typed middleware that returns an error (see TypedHandlerE).
+type TypedMiddlewareE[C any] func(*C, ResponseWriter, *Request, NextMiddlewareFunc) error
+
+// TypedErrorHandlerE is a typed error handler that can return an error,
+// which is passed on to the Error handler of the nearest parent that has one.
+type TypedErrorHandlerE[C any] func(*C, ResponseWriter, *Request, interface{}) error
+
+// TypedOptionsHandler is an OPTIONS handler whose context type is checked at compile time.
+type TypedOptionsHandler[C any] func(*C, ResponseWriter, *Request, []string)
+
+// TypedRouter is a Router whose handlers and middleware are checked against the context type C at compile time.
+// Since it embeds the untyped *Router, generic middleware and interface{} handlers can still be attached
+// through r.Router, which allows migrating an existing router tree one router at a time.
+type TypedRouter[C any] struct {
+	*Router
+}
+
+// NewTyped returns a new typed router with context type C.
+// On each request, an instance of C will be automatically allocated and sent to handlers.
+func NewTyped[C any]() *TypedRouter[C] {
+	var ctx C
+	return &TypedRouter[C]{Router: New(ctx)}
+}
+
+// NewTypedWithPrefix returns a new typed router (see NewTyped) but each route will have an implicit prefix.
+func NewTypedWithPrefix[C any](pathPrefix string) *TypedRouter[C] {
+	var ctx C
+	return &TypedRouter[C]{Router: NewWithPrefix(ctx, pathPrefix)}
+}
+
+// Typed wraps an existing router so typed handlers can be added to it.
+// It panics if the router's context type isn't C.
+func Typed[C any](r *Router) *TypedRouter[C] {
+	if r.contextType != reflect.TypeOf((*C)(nil)).Elem() {
+		panic(fmt.Sprintf("web: router has context type %v, not %v", r.contextType, reflect.TypeOf((*C)(nil)).Elem()))
+	}
+	return &TypedRouter[C]{Router: r}
+}
+
+// Subrouter attaches a new typed subrouter with context type C to parent and returns it.
+// C can be the same as P, or it must have a field that points to P or to the context of a router further up (see Router.Subrouter).
+func Subrouter[P, C any](parent *TypedRouter[P], pathPrefix string) *TypedRouter[C] {
+	var ctx C
+	return &TypedRouter[C]{Router: parent.Router.Subrouter(ctx, pathPrefix)}
+}
+
+// Middleware adds the specified middleware to the router and returns the router.
+func (r *TypedRouter[C]) Middleware(fn TypedMiddleware[C]) *TypedRouter[C] {
+	r.Router.middleware = append(r.Router.middleware, typedMiddlewareHandler(reflect.ValueOf(fn), fn.withError()))
+	return r
+}
+
+// MiddlewareE adds the specified middleware, which can return an error, to the router and returns the router.
+func (r *TypedRouter[C]) MiddlewareE(fn TypedMiddlewareE[C]) *TypedRouter[C] {
+	r.Router.middleware = append(r.Router.middleware, typedMiddlewareHandler(reflect.ValueOf(fn), fn))
+	return r
+}
+
+// RoutedMiddleware adds middleware that runs once the request has been routed and returns the router.
+// See Router.RoutedMiddleware.
+func (r *TypedRouter[C]) RoutedMiddleware(fn TypedMiddleware[C]) *TypedRouter[C] {
+	return r.addRoutedMiddleware(typedMiddlewareHandler(reflect.ValueOf(fn), fn.withError()))
+}
+
+// RoutedMiddlewareE adds routed middleware that can return an error and returns the router.
+// See Router.RoutedMiddleware.
+func (r *TypedRouter[C]) RoutedMiddlewareE(fn TypedMiddlewareE[C]) *TypedRouter[C] {
+	return r.addRoutedMiddleware(typedMiddlewareHandler(reflect.ValueOf(fn), fn))
+}
+
+func (r *TypedRouter[C]) addRoutedMiddleware(mw *middlewareHandler) *TypedRouter[C] {
+	if r.parent != nil {
+		panic("You can only add RoutedMiddleware to the root router.")
+	}
+	r.Router.routedMiddleware = append(r.Router.routedMiddleware, mw)
+	return r
+}
+
+// withError returns fn as middleware that never returns an error.
+func (fn TypedMiddleware[C]) withError() TypedMiddlewareE[C] {
+	return func(c *C, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+		fn(c, rw, req, next)
+		return nil
+	}
+}
+
+// typedMiddlewareHandler returns the handler for fn, named after vfn, the function it was added as.
+func typedMiddlewareHandler[C any](vfn reflect.Value, fn TypedMiddlewareE[C]) *middlewareHandler {
+	return &middlewareHandler{
+		Name: funcName(vfn),
+		ContextMiddleware: func(ctx reflect.Value, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+			return fn(ctx.Interface().(*C), rw, req, next)
+		},
+	}
+}
+
+// Error sets the specified function as the error handler (when panics happen) and returns the router.
+func (r *TypedRouter[C]) Error(fn TypedErrorHandler[C]) *TypedRouter[C] {
+	r.Router.errorHandler = reflect.ValueOf((func(*C, ResponseWriter, *Request, interface{}))(fn))
+	return r
+}
+
+// ErrorE sets the specified function as the error handler and returns the router.
+// An error it returns is passed on to the Error handler of the nearest parent that has one.
+func (r *TypedRouter[C]) ErrorE(fn TypedErrorHandlerE[C]) *TypedRouter[C] {
+	r.Router.errorHandler = reflect.ValueOf((func(*C, ResponseWriter, *Request, interface{}) error)(fn))
+	return r
+}
+
+// NotFound sets the specified function as the not-found handler (when no route matches) and returns the router.
+// See Router.NotFound.
+func (r *TypedRouter[C]) NotFound(fn TypedHandler[C]) *TypedRouter[C] {
+	r.Router.NotFound((func(*C, ResponseWriter, *Request))(fn))
+	return r
+}
+
+// OptionsHandler sets the specified function as the options handler and returns the router.
+// See Router.OptionsHandler.
+func (r *TypedRouter[C]) OptionsHandler(fn TypedOptionsHandler[C]) *TypedRouter[C] {
+	r.Router.OptionsHandler((func(*C, ResponseWriter, *Request, []string))(fn))
+	return r
+}
+
+// Get will add a route to the router that matches on GET requests and the specified path.
+func (r *TypedRouter[C]) Get(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodGet, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// GetE is like Get, for a handler that returns an error.
+func (r *TypedRouter[C]) GetE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodGet, path, reflect.ValueOf(fn), fn)
+}
+
+// Post will add a route to the router that matches on POST requests and the specified path.
+func (r *TypedRouter[C]) Post(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodPost, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// PostE is like Post, for a handler that returns an error.
+func (r *TypedRouter[C]) PostE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodPost, path, reflect.ValueOf(fn), fn)
+}
+
+// Put will add a route to the router that matches on PUT requests and the specified path.
+func (r *TypedRouter[C]) Put(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodPut, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// PutE is like Put, for a handler that returns an error.
+func (r *TypedRouter[C]) PutE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodPut, path, reflect.ValueOf(fn), fn)
+}
+
+// Delete will add a route to the router that matches on DELETE requests and the specified path.
+func (r *TypedRouter[C]) Delete(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodDelete, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// DeleteE is like Delete, for a handler that returns an error.
+func (r *TypedRouter[C]) DeleteE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodDelete, path, reflect.ValueOf(fn), fn)
+}
+
+// Patch will add a route to the router that matches on PATCH requests and the specified path.
+func (r *TypedRouter[C]) Patch(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodPatch, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// PatchE is like Patch, for a handler that returns an error.
+func (r *TypedRouter[C]) PatchE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodPatch, path, reflect.ValueOf(fn), fn)
+}
+
+// Head will add a route to the router that matches on HEAD requests and the specified path.
+func (r *TypedRouter[C]) Head(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodHead, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// HeadE is like Head, for a handler that returns an error.
+func (r *TypedRouter[C]) HeadE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodHead, path, reflect.ValueOf(fn), fn)
+}
+
+// Options will add a route to the router that matches on OPTIONS requests and the specified path.
+func (r *TypedRouter[C]) Options(path string, fn TypedHandler[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodOptions, path, reflect.ValueOf(fn), fn.withError())
+}
+
+// OptionsE is like Options, for a handler that returns an error.
+func (r *TypedRouter[C]) OptionsE(path string, fn TypedHandlerE[C]) *TypedRouter[C] {
+	return r.addRoute(httpMethodOptions, path, reflect.ValueOf(fn), fn)
+}
+
+func (r *TypedRouter[C]) addRoute(method httpMethod, path string, vfn reflect.Value, fn TypedHandlerE[C]) *TypedRouter[C] {
+	r.Router.addActionHandler(method, path, &actionHandler{
+		Name: funcName(vfn),
+		ContextHandler: func(ctx reflect.Value, rw ResponseWriter, req *Request) error {
+			return fn(ctx.Interface().(*C), rw, req)
+		},
+	})
+	return r
+}
+
+// withError returns fn as a handler that never returns an error.
+func (fn TypedHandler[C]) withError() TypedHandlerE[C] {
+	return func(c *C, rw ResponseWriter, req *Request) error {
+		fn(c, rw, req)
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+package grom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TypedContext struct {
+	Value string
+}
+
+type TypedAdminContext struct {
+	*TypedContext
+	Admin string
+}
+
+func (c *TypedContext) SetValue(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+	c.Value = "root"
+	next(rw, req)
+}
+
+func (c *TypedContext) Action(rw ResponseWriter, req *Request) {
+	fmt.Fprintf(rw, "typed-%s", c.Value)
+}
+
+func (c *TypedAdminContext) SetAdmin(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+	c.Admin = "admin"
+	next(rw, req)
+}
+
+func (c *TypedAdminContext) Action(rw ResponseWriter, req *Request) {
+	fmt.Fprintf(rw, "typed-%s-%s", c.Value, c.Admin)
+}
+
+func (c *TypedAdminContext) ErrorHandler(rw ResponseWriter, req *Request, err interface{}) {
+	rw.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(rw, "typed-error-%s", c.Admin)
+}
+
+func (c *TypedAdminContext) ErrorAction(rw ResponseWriter, req *Request) {
+	panic("boom")
+}
+
+func TestTypedRouter(t *testing.T) {
+	router := NewTyped[TypedContext]()
+	router.Middleware((*TypedContext).SetValue)
+	router.Get("/action", (*TypedContext).Action)
+
+	admin := Subrouter[TypedContext, TypedAdminContext](router, "/admin")
+	admin.Middleware((*TypedAdminContext).SetAdmin)
+	admin.Error((*TypedAdminContext).ErrorHandler)
+	admin.Get("/action", (*TypedAdminContext).Action)
+	admin.Get("/error", (*TypedAdminContext).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "typed-root", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "typed-root-admin", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/error")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "typed-error-admin", http.StatusInternalServerError)
+}
+
+func TestTypedRouterErrors(t *testing.T) {
+	router := NewTyped[TypedContext]()
+	router.ErrorE(func(c *TypedContext, rw ResponseWriter, req *Request, err interface{}) error {
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "root-error-%v", err)
+		return nil
+	})
+	router.MiddlewareE(func(c *TypedContext, rw ResponseWriter, req *Request, next NextMiddlewareFunc) error {
+		if req.URL.Query().Get("deny") != "" {
+			return Forbidden("denied")
+		}
+		next(rw, req)
+		return nil
+	})
+	router.GetE("/action", func(c *TypedContext, rw ResponseWriter, req *Request) error {
+		return errors.New("boom")
+	})
+	router.PostE("/ok", func(c *TypedContext, rw ResponseWriter, req *Request) error {
+		fmt.Fprint(rw, "ok")
+		return nil
+	})
+
+	admin := Subrouter[TypedContext, TypedAdminContext](router, "/admin")
+	admin.ErrorE(func(c *TypedAdminContext, rw ResponseWriter, req *Request, err interface{}) error {
+		return fmt.Errorf("admin: %v", err)
+	})
+	admin.Get("/error", (*TypedAdminContext).ErrorAction)
+
+	rw, req := newTestRequest("GET", "/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root-error-boom", http.StatusInternalServerError)
+
+	rw, req = newTestRequest("POST", "/ok")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "ok", http.StatusOK)
+
+	rw, req = newTestRequest("POST", "/ok?deny=1")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root-error-denied", http.StatusInternalServerError)
+
+	rw, req = newTestRequest("GET", "/admin/error")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "root-error-admin: boom", http.StatusInternalServerError)
+}
+
+func TestTypedRouterInterop(t *testing.T) {
+	router := New(TypedContext{})
+	router.Middleware(func(rw ResponseWriter, req *Request, next NextMiddlewareFunc) {
+		fmt.Fprintf(rw, "generic ")
+		next(rw, req)
+	})
+	router.Middleware((*TypedContext).SetValue)
+
+	typed := Typed[TypedContext](router)
+	typed.Get("/typed", (*TypedContext).Action)
+	typed.Router.Get("/dynamic", (*TypedContext).Action)
+
+	admin := Subrouter[TypedContext, TypedAdminContext](typed, "/admin")
+	admin.Router.Middleware((*TypedAdminContext).SetAdmin)
+	admin.Get("/action", (*TypedAdminContext).Action)
+
+	rw, req := newTestRequest("GET", "/typed")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic typed-root", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/dynamic")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic typed-root", http.StatusOK)
+
+	rw, req = newTestRequest("GET", "/admin/action")
+	router.ServeHTTP(rw, req)
+	assertResponse(t, rw, "generic typed-root-admin", http.StatusOK)
+}
+
+func TestTypedRouterInvalid(t *testing.T) {
+	assert.Panics(t, func() {
+		Typed[TypedAdminContext](New(TypedContext{}))
+	})
+
+	assert.Panics(t, func() {
+		NewTyped[int]()
+	})
+
+	assert.Panics(t, func() {
+		Subrouter[TypedContext, invalidSubcontext](NewTyped[TypedContext](), "/admin")
+	})
+}